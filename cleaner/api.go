@@ -0,0 +1,31 @@
+package cleaner
+
+import (
+	"context"
+
+	"github.com/slack-go/slack"
+)
+
+// API is the part of the slack client a Cleaner uses. It is met by
+// *slack.Client, and lets a fake stand in for slack when testing code built
+// on this package.
+type API interface {
+	AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error)
+	GetConversationsContext(ctx context.Context, params *slack.GetConversationsParameters) ([]slack.Channel, string, error)
+	GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	GetConversationInfoContext(ctx context.Context, channelID string, includeLocale bool) (*slack.Channel, error)
+	UnArchiveConversationContext(ctx context.Context, channelID string) error
+	ArchiveConversationContext(ctx context.Context, channelID string) error
+	GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error)
+	OpenConversationContext(ctx context.Context, params *slack.OpenConversationParameters) (*slack.Channel, bool, bool, error)
+	GetUserByEmailContext(ctx context.Context, email string) (*slack.User, error)
+	ListPinsContext(ctx context.Context, channel string) ([]slack.Item, *slack.Paging, error)
+	DeleteMessageContext(ctx context.Context, channel, messageTimestamp string) (string, string, error)
+	UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+	DeleteFileContext(ctx context.Context, fileID string) error
+	RemoveReactionContext(ctx context.Context, name string, item slack.ItemRef) error
+	GetScheduledMessagesContext(ctx context.Context, params *slack.GetScheduledMessagesParameters) ([]slack.ScheduledMessage, string, error)
+	DeleteScheduledMessageContext(ctx context.Context, params *slack.DeleteScheduledMessageParameters) (bool, error)
+}
+
+var _ API = (*slack.Client)(nil)
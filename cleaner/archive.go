@@ -0,0 +1,110 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+// archivedReason is the Unavailable reason of an archived conversation that
+// was skipped.
+const archivedReason = "is_archived"
+
+// unarchive checks whether conv, described by info, is archived, which slack
+// does not delete messages in. Without opts.Unarchive an archived conv is
+// marked Unavailable in stats so it is skipped, otherwise it is unarchived
+// for the cleaning and the returned func archives it again when
+// opts.Rearchive is set. In a dry run nothing is changed, since only the
+// history is read. A nil info is taken as not archived.
+func (c *Cleaner) unarchive(ctx context.Context, conv string, info *slack.Channel, stats *ConvStats) (func(), error) {
+	noop := func() {}
+	if info == nil || !info.IsArchived {
+		return noop, nil
+	}
+	if !c.opts.Unarchive {
+		stats.Unavailable = archivedReason
+		LogEvent(LevelWarn, "channel_skipped",
+			fmt.Sprintf("Skipping channel %s, it is archived, use --unarchive to clean it", conv),
+			"channel", conv, "error", archivedReason)
+		return noop, nil
+	}
+	if c.opts.DryRun {
+		LogEvent(LevelInfo, "would_unarchive", fmt.Sprintf("Dry run: would unarchive channel %s to clean it", conv),
+			"channel", conv)
+		return noop, nil
+	}
+	callCtx, cancel := callContext(ctx)
+	err := c.api.UnArchiveConversationContext(callCtx, conv)
+	cancel()
+	if err != nil {
+		return noop, fmt.Errorf("unarchiving: %w", err)
+	}
+	LogEvent(LevelInfo, "unarchived", fmt.Sprintf("Unarchived channel %s to clean it", conv), "channel", conv)
+	if !c.opts.Rearchive {
+		return noop, nil
+	}
+	return func() {
+		// The run may have been cancelled, but the channel should still be
+		// put back the way it was.
+		callCtx, cancel := callContext(context.Background())
+		defer cancel()
+		err := c.api.ArchiveConversationContext(callCtx, conv)
+		if err != nil {
+			LogEvent(LevelError, "rearchive_failed", fmt.Sprintf("Archiving channel %s again failed: %s", conv, err),
+				"channel", conv, "error", err.Error())
+			return
+		}
+		LogEvent(LevelInfo, "rearchived", fmt.Sprintf("Archived channel %s again", conv), "channel", conv)
+	}, nil
+}
+
+// flagShared warns when conv, described by info, is shared with other
+// organizations through Slack Connect, and marks it in stats for the summary.
+// Slack only lets the messages of the other organizations be deleted by them,
+// so those are counted as denied rather than stopping the run.
+func (c *Cleaner) flagShared(conv string, info *slack.Channel, stats *ConvStats) {
+	if info == nil || !info.IsExtShared {
+		return
+	}
+	stats.ExtShared = true
+	LogEvent(LevelWarn, "channel_shared",
+		fmt.Sprintf("Channel %s is shared with other organizations, their messages can not be deleted", conv),
+		"channel", conv)
+}
+
+// flagAppHome logs when conv, described by info, is the Messages tab of the
+// bot's App Home with a user. For a bot token that tab is the DM the bot has
+// with the user, so it is cleaned like any other DM. The Home tab itself is a
+// view the app publishes rather than a conversation, and has no messages to
+// delete.
+func (c *Cleaner) flagAppHome(conv string, info *slack.Channel) {
+	if info == nil || !info.IsIM || TokenKind(c.config.Token, nil) != TokenBot || !c.verbose() {
+		return
+	}
+	LogEvent(LevelDebug, "app_home",
+		fmt.Sprintf("Channel %s is the App Home messages tab with user %s", conv, info.User),
+		"channel", conv, "user", info.User)
+}
+
+// conversationInfo returns the conversations.info of conv.
+func (c *Cleaner) conversationInfo(ctx context.Context, conv string) (*slack.Channel, error) {
+	for {
+		callCtx, cancel := callContext(ctx)
+		info, err := c.api.GetConversationInfoContext(callCtx, conv, false)
+		cancel()
+		if err != nil {
+			if wait, ok := c.rateLimitWait(err); ok {
+				LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+					"channel", conv, "wait", wait.String())
+				err = sleep(ctx, wait)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+		return info, nil
+	}
+}
@@ -0,0 +1,148 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/slack-go/slack"
+)
+
+// Bookmark is a bookmark of a conversation, such as a link saved to the top
+// of a channel.
+type Bookmark struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+}
+
+// BookmarkAPI lists and removes the bookmarks of a conversation. The slack
+// client does not cover bookmarks, so Options.ClearBookmarks needs the API
+// passed to New to also meet BookmarkAPI, as a Client does.
+type BookmarkAPI interface {
+	ListBookmarksContext(ctx context.Context, channelID string) ([]Bookmark, error)
+	RemoveBookmarkContext(ctx context.Context, channelID, bookmarkID string) error
+}
+
+// ListBookmarksContext returns the bookmarks of channelID. bookmarks.list
+// returns them all at once, without paging.
+func (w *webAPI) ListBookmarksContext(ctx context.Context, channelID string) ([]Bookmark, error) {
+	var resp struct {
+		Bookmarks []Bookmark `json:"bookmarks"`
+	}
+	_, err := w.call(ctx, "bookmarks.list", url.Values{"channel_id": {channelID}}, &resp)
+	return resp.Bookmarks, err
+}
+
+// RemoveBookmarkContext removes the bookmark bookmarkID of channelID.
+func (w *webAPI) RemoveBookmarkContext(ctx context.Context, channelID, bookmarkID string) error {
+	_, err := w.call(ctx, "bookmarks.remove", url.Values{"channel_id": {channelID}, "bookmark_id": {bookmarkID}}, nil)
+	return err
+}
+
+// clearBookmarks removes the bookmarks of conv, for opts.ClearBookmarks, or
+// only logs them when opts.DryRun is set. Slack errors, such as a token
+// without the bookmarks scopes, are logged and skip the rest of the
+// bookmarks, since they should not fail a conversation whose messages were
+// cleaned.
+func (c *Cleaner) clearBookmarks(ctx context.Context, conv string, stats *ConvStats) error {
+	var bookmarks []Bookmark
+	for {
+		callCtx, cancel := callContext(ctx)
+		var err error
+		bookmarks, err = c.bookmarks.ListBookmarksContext(callCtx, conv)
+		cancel()
+		if err == nil {
+			break
+		}
+		if wait, ok := c.rateLimitWait(err); ok {
+			stats.RateLimits++
+			LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+				"channel", conv, "wait", wait.String())
+			err = sleep(ctx, wait)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if skipBookmarks(conv, err) {
+			return nil
+		}
+		return fmt.Errorf("listing bookmarks: %w", err)
+	}
+	for _, b := range bookmarks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.opts.DryRun {
+			if c.verbose() {
+				LogEvent(LevelDebug, "would_remove_bookmark",
+					fmt.Sprintf("Dry run: would remove bookmark %q in channel %s", b.Title, conv),
+					"channel", conv, "bookmark", b.ID)
+			}
+			stats.Bookmarks++
+			continue
+		}
+		err := c.removeBookmark(ctx, conv, b, stats)
+		if skipBookmarks(conv, err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if stats.Bookmarks > 0 && !c.opts.Quiet {
+		msg := fmt.Sprintf("Removed %d bookmarks from %s", stats.Bookmarks, conv)
+		if c.opts.DryRun {
+			msg = fmt.Sprintf("Dry run: would remove %d bookmarks from %s", stats.Bookmarks, conv)
+		}
+		LogEvent(LevelInfo, "bookmarks_done", msg, "channel", conv, "count", stats.Bookmarks)
+	}
+	return nil
+}
+
+// removeBookmark removes the bookmark b of conv, waiting out rate limits.
+func (c *Cleaner) removeBookmark(ctx context.Context, conv string, b Bookmark, stats *ConvStats) error {
+	for {
+		err := c.throttle(ctx)
+		if err != nil {
+			return err
+		}
+		callCtx, cancel := callContext(ctx)
+		err = c.bookmarks.RemoveBookmarkContext(callCtx, conv, b.ID)
+		cancel()
+		if err == nil {
+			stats.limited = 0
+			stats.Bookmarks++
+			if c.verbose() {
+				LogEvent(LevelDebug, "remove_bookmark",
+					fmt.Sprintf("Removed bookmark %q in channel %s", b.Title, conv),
+					"channel", conv, "bookmark", b.ID)
+			}
+			return nil
+		}
+		if wait, ok := c.rateLimitWait(err); ok {
+			stats.RateLimits++
+			wait = stats.backoff(wait)
+			LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, pausing deletes for %s", wait),
+				"channel", conv, "bookmark", b.ID, "wait", wait.String())
+			c.pause.extend(wait)
+			continue
+		}
+		return err
+	}
+}
+
+// skipBookmarks reports whether err is one slack returned, which is logged
+// as skipping the bookmarks of conv.
+func skipBookmarks(conv string, err error) bool {
+	var slackErr slack.SlackErrorResponse
+	if !errors.As(err, &slackErr) {
+		return false
+	}
+	LogEvent(LevelWarn, "bookmarks_skipped",
+		fmt.Sprintf("Skipping the bookmarks of channel %s: %s", conv, err),
+		"channel", conv, "error", err.Error())
+	return true
+}
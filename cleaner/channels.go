@@ -0,0 +1,107 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// channelResolver maps channel names to IDs. The workspace's channels are only
+// listed the first time a name is looked up, and then reused for any others.
+type channelResolver struct {
+	api API
+	ids map[string]string
+	// wait is the fallback sleep on a rate limit, see rateLimitWait.
+	wait time.Duration
+	// team, when set, is the Enterprise Grid workspace channels are listed
+	// from.
+	team string
+}
+
+func newChannelResolver(api API, wait time.Duration, team string) *channelResolver {
+	return &channelResolver{api: api, wait: wait, team: team}
+}
+
+// resolve returns the ID of the channel called name, with or without the
+// leading #.
+func (r *channelResolver) resolve(ctx context.Context, name string) (string, error) {
+	name = strings.TrimPrefix(name, "#")
+	if r.ids == nil {
+		err := r.load(ctx)
+		if err != nil {
+			return "", fmt.Errorf("listing channels to resolve #%s: %w", name, err)
+		}
+	}
+	id, ok := r.ids[name]
+	if !ok {
+		return "", fmt.Errorf("no channel named #%s found", name)
+	}
+	return id, nil
+}
+
+// glob returns the IDs of the channels whose names match the path.Match
+// pattern, with or without the leading #, sorted by name.
+func (r *channelResolver) glob(ctx context.Context, pattern string) ([]string, error) {
+	pattern = strings.TrimPrefix(pattern, "#")
+	if r.ids == nil {
+		err := r.load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing channels to match #%s: %w", pattern, err)
+		}
+	}
+	var names []string
+	for name := range r.ids {
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel pattern #%s: %w", pattern, err)
+		}
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	ids := make([]string, len(names))
+	for i, name := range names {
+		ids[i] = r.ids[name]
+	}
+	return ids, nil
+}
+
+// load pages through conversations.list and fills in the name to ID map.
+func (r *channelResolver) load(ctx context.Context) error {
+	ids := make(map[string]string)
+	params := slack.GetConversationsParameters{
+		Types:  []string{"public_channel", "private_channel"},
+		Limit:  1000,
+		TeamID: r.team,
+	}
+	for {
+		channels, cursor, err := r.api.GetConversationsContext(ctx, &params)
+		if err != nil {
+			if wait, ok := rateLimitWait(err, r.wait); ok {
+				LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+					"wait", wait.String())
+				err = sleep(ctx, wait)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		for _, c := range channels {
+			ids[c.Name] = c.ID
+		}
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+	r.ids = ids
+	return nil
+}
@@ -0,0 +1,96 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// checkpoint records how far each conversation has been cleaned, so an
+// interrupted run can carry on where it stopped. A nil checkpoint records
+// nothing.
+type checkpoint struct {
+	path string
+
+	mu       sync.Mutex
+	Channels map[string]channelCheckpoint `json:"channels"`
+}
+
+// channelCheckpoint is the saved state of a single conversation.
+type channelCheckpoint struct {
+	Cursor string `json:"cursor,omitempty"`
+	// Oldest is how far an oldest first run has got, see Options.OldestFirst.
+	Oldest string `json:"oldest,omitempty"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// loadCheckpoint reads the checkpoint file at path, starting a new one if it
+// does not exist yet.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{path: path, Channels: make(map[string]channelCheckpoint)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Channels == nil {
+		c.Channels = make(map[string]channelCheckpoint)
+	}
+	return c, nil
+}
+
+// get returns the saved state of conv.
+func (c *checkpoint) get(conv string) channelCheckpoint {
+	if c == nil {
+		return channelCheckpoint{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Channels[conv]
+}
+
+// save records the state of conv and writes the checkpoint file.
+func (c *checkpoint) save(conv string, state channelCheckpoint) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Channels[conv] = state
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, b, 0o644)
+}
+
+// writeFileAtomic writes b to a temporary file next to p and renames it over
+// p, so a crash mid write can not leave a truncated file behind. The file is
+// given perm, since CreateTemp makes it private, and a metrics file for one
+// is read by node_exporter as another user.
+func writeFileAtomic(p string, b []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
@@ -0,0 +1,634 @@
+// Package cleaner deletes the message history of slack conversations, such as
+// the DMs between a bot and its users.
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"golang.org/x/time/rate"
+)
+
+// Options control how a Cleaner goes about a run.
+type Options struct {
+	// DryRun only logs the messages that would be deleted.
+	DryRun bool
+	// Concurrency is the number of conversations cleaned at the same time.
+	// Each conversation is cleaned by a single worker, deleting its messages
+	// one at a time in the order of its history, so paging is never shared.
+	Concurrency int
+	// ExportDir, when set, is where the history of each conversation is
+	// written as <channel>.json before anything is deleted.
+	ExportDir string
+	// MaxAttempts is the number of times deleting a message is tried before
+	// giving up.
+	MaxAttempts int
+	// ProgressEvery logs the running total of a conversation every N
+	// deleted messages, 0 to disable.
+	ProgressEvery int
+	// Quiet only logs the summary of each conversation, leaving out the line
+	// logged for every page, as well as the line logged at the debug level
+	// for every single message, file and reaction removed.
+	Quiet bool
+	// SkipThreads leaves thread replies alone.
+	SkipThreads bool
+	// KeepFiles leaves the files uploaded with a message in place.
+	KeepFiles bool
+	// ClearReactions removes the bot's own reactions from each message before
+	// deleting it.
+	ClearReactions bool
+	// ClearBookmarks also removes the bookmarks of each conversation once
+	// its messages are cleaned.
+	ClearBookmarks bool
+	// KeepPinned leaves the pinned messages of each conversation alone.
+	KeepPinned bool
+	// KeepReacted leaves the messages that got any reactions alone, and
+	// OnlyReacted only deletes those. Only one of them can be set.
+	KeepReacted bool
+	OnlyReacted bool
+	// Unarchive unarchives archived conversations to clean them, rather than
+	// skipping them, and Rearchive archives them again afterwards.
+	Unarchive bool
+	Rearchive bool
+	// IncludeScheduled also deletes the messages scheduled to be posted in
+	// each conversation, once its history is done.
+	IncludeScheduled bool
+	// MaxMessages stops each conversation after this many deletions, 0 for
+	// no limit.
+	MaxMessages int
+	// OldestFirst walks the history forward from the oldest message, so a
+	// run that is cut short has cleaned the oldest messages rather than the
+	// newest.
+	OldestFirst bool
+	// PageSize is the number of messages fetched per history call, up to
+	// MaxPageSize. 0 leaves it to slack's default.
+	PageSize int
+	// Verify reads each conversation again once it has been cleaned, and
+	// counts the messages the filters would still delete as Leftover.
+	Verify bool
+	// Redact, when set, edits each message to this text and drops its
+	// attachments and blocks instead of deleting it, keeping its place and
+	// thread. The messages redacted are counted as Deleted. It can not be
+	// combined with Verify or IncludeScheduled.
+	Redact string
+	// Estimate counts the messages to delete in each conversation before
+	// starting on it, so progress logs can give an estimate of the time
+	// remaining.
+	Estimate bool
+	// OlderThan, when set, skips every message newer than this. It is
+	// combined with the config's before, the earlier of the two winning.
+	OlderThan time.Duration
+	// RateLimitWait is how long to sleep on a rate limit that does not say
+	// when to retry, 0 for DefaultRateLimitWait.
+	RateLimitWait time.Duration
+	// RetryWait is how long to wait before retrying a delete that failed
+	// with a transient error, doubled for each attempt after, 0 for
+	// DefaultRetryWait.
+	RetryWait time.Duration
+	// Rate is the most messages deleted per second across all workers, 0
+	// for no limit.
+	Rate float64
+	// Delay is a fixed sleep before every delete call of each worker, on
+	// top of Rate, for a throttle that is simpler to reason about.
+	Delay time.Duration
+	// ChannelDelay is how long each worker waits after finishing a
+	// conversation before it starts on the next one, 0 for not at all.
+	ChannelDelay time.Duration
+	// FailFast stops starting on any more conversations once one has failed,
+	// rather than cleaning the rest and returning all the errors at the end.
+	// Those already being cleaned by other workers are finished.
+	FailFast bool
+	// WebhookTimeout is how long posting to the config's webhook may take,
+	// 0 for DefaultWebhookTimeout.
+	WebhookTimeout time.Duration
+	// HTTPClient is what the webhook is posted with, nil for
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// ReportPath, when set, is the CSV file Run writes a row to for every
+	// message it deletes, or would delete in a dry run.
+	ReportPath string
+	// SinceLastRun only reads the messages posted since the newest one the
+	// last successful run saw inside the before/after window, as recorded in
+	// the file at StatePath, or DefaultStatePath when that is empty.
+	SinceLastRun bool
+	StatePath    string
+	// CheckpointPath, when set, is the file progress is recorded in and
+	// resumed from.
+	CheckpointPath string
+	// Confirm, when set, is called with the resolved conversations before
+	// anything is deleted, and the run only goes ahead if it returns true.
+	// It is not called for a dry run.
+	Confirm func(convs []string) (bool, error)
+	// MaxChannels, when set, is the most conversations a run cleans unless
+	// Force is set, as a guard against a pattern matching far more than
+	// meant. A dry run is never held back by it.
+	MaxChannels int
+	Force       bool
+	// Progress, when set, is sent an update as the run starts cleaning, on
+	// every message deleted, every rate limit and as each conversation is
+	// done. The sends block, so it has to be read from until Run returns.
+	Progress chan<- Progress
+}
+
+// MaxPageSize is the most messages slack returns from one history call.
+const MaxPageSize = 1000
+
+// Cleaner deletes the history of the conversations in a Config.
+type Cleaner struct {
+	api       API
+	bookmarks BookmarkAPI
+	scopes    ScopesAPI
+	config    *Config
+	opts      Options
+
+	// limiter throttles the delete calls of every worker to opts.Rate, and
+	// pause holds them all back after a rate limit. Everything else about a
+	// conversation, such as its cursor and stats, belongs to its worker.
+	limiter *rate.Limiter
+	pause   pause
+	// olderThan is the before bound of opts.OlderThan, zero when unset, and
+	// windows the windows of the conversations whose config entry has one,
+	// set once by ResolveTargets.
+	olderThan time.Time
+	windows   map[string]*window
+	// checkpoint is loaded by Run from opts.CheckpointPath.
+	checkpoint *checkpoint
+	// state is loaded by Run when opts.SinceLastRun is set.
+	state *runState
+	// report is opened by Run from opts.ReportPath.
+	report *reporter
+	// self is the bot's user ID, set by Run or looked up when first needed.
+	self selfUser
+}
+
+// Result is the outcome of Run, with the stats of each conversation cleaned.
+type Result struct {
+	Convs []string
+	Stats []ConvStats
+	// Elapsed is how long the cleaning took, from the first conversation
+	// started to the last one finished.
+	Elapsed time.Duration
+	// Identities are who the token cleaned as, one for each workspace of
+	// the results.
+	Identities []Identity
+}
+
+// Identity is who a token belongs to, as told by auth.test.
+type Identity struct {
+	User   string `json:"user"`
+	UserID string `json:"user_id"`
+	Team   string `json:"team"`
+	TeamID string `json:"team_id"`
+}
+
+// New returns a Cleaner that uses api, usually a Client, to clean the
+// conversations in config. A plain *slack.Client works too, without the scope
+// check of Run and without Options.ClearBookmarks.
+func New(api API, config *Config, opts Options) (*Cleaner, error) {
+	err := config.compile()
+	if err != nil {
+		return nil, err
+	}
+	var olderThan time.Time
+	if opts.OlderThan > 0 {
+		olderThan = time.Now().Add(-opts.OlderThan)
+		if config.before.IsZero() || olderThan.Before(config.before) {
+			config.before = olderThan
+		}
+	}
+	if opts.PageSize < 0 || opts.PageSize > MaxPageSize {
+		return nil, fmt.Errorf("page size must be between 1 and %d, got %d", MaxPageSize, opts.PageSize)
+	}
+	if opts.KeepReacted && opts.OnlyReacted {
+		return nil, errors.New("keeping and only deleting the messages with reactions can not be combined")
+	}
+	if opts.Redact != "" && (opts.Verify || opts.IncludeScheduled) {
+		return nil, errors.New("redacting can not be combined with verifying or deleting scheduled messages")
+	}
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if opts.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+	bookmarks, _ := api.(BookmarkAPI)
+	if opts.ClearBookmarks && bookmarks == nil {
+		return nil, errors.New("clearing bookmarks needs an API that is also a BookmarkAPI, such as a Client")
+	}
+	scopes, _ := api.(ScopesAPI)
+	return &Cleaner{
+		api:       api,
+		bookmarks: bookmarks,
+		scopes:    scopes,
+		config:    config,
+		opts:      opts,
+		limiter:   limiter,
+		olderThan: olderThan,
+	}, nil
+}
+
+// Run checks the token, resolves the conversations and cleans them with
+// opts.Concurrency workers. The errors of every worker are returned together
+// once they have all finished, along with the stats of each conversation.
+// Once ctx is done no new conversation or message is started. A nil Result
+// means the run was not confirmed.
+func (c *Cleaner) Run(ctx context.Context) (*Result, error) {
+
+	if c.opts.ExportDir != "" {
+		err := checkExportDir(c.opts.ExportDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	auth, err := c.api.AuthTestContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	}
+	LogEvent(LevelInfo, "authenticated",
+		fmt.Sprintf("Authenticated as %s (%s) in team %s", auth.User, auth.UserID, auth.Team),
+		"user", auth.User, "user_id", auth.UserID, "team", auth.Team)
+	c.self.id = auth.UserID
+	kind := TokenKind(c.config.Token, auth)
+	for _, w := range c.config.TokenWarnings(kind, auth.UserID) {
+		LogEvent(LevelWarn, "token_kind", fmt.Sprintf("WARNING: %s", w), "kind", kind)
+	}
+	err = c.checkScopes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	convs, err := c.ResolveConversations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.opts.SinceLastRun {
+		p := c.opts.StatePath
+		if p == "" {
+			p = DefaultStatePath
+		}
+		c.state, err = loadState(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading state: %w", err)
+		}
+	}
+
+	if c.opts.CheckpointPath != "" {
+		c.checkpoint, err = loadCheckpoint(c.opts.CheckpointPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading checkpoint: %w", err)
+		}
+		var todo []string
+		for _, conv := range convs {
+			if c.checkpoint.get(conv).Done {
+				LogEvent(LevelInfo, "checkpoint_skip", fmt.Sprintf("Skipping channel %s, already done in checkpoint", conv),
+					"channel", conv)
+				continue
+			}
+			todo = append(todo, conv)
+		}
+		convs = todo
+	}
+
+	if !c.opts.DryRun && !c.opts.Force && c.opts.MaxChannels > 0 && len(convs) > c.opts.MaxChannels {
+		LogEvent(LevelWarn, "too_many_channels",
+			fmt.Sprintf("The settings resolve to %d conversations, more than the limit of %d", len(convs), c.opts.MaxChannels),
+			"count", len(convs), "max", c.opts.MaxChannels)
+		return nil, fmt.Errorf("%w: %d, more than the limit of %d", ErrTooManyChannels, len(convs), c.opts.MaxChannels)
+	}
+
+	if !c.opts.DryRun && c.opts.Confirm != nil {
+		ok, err := c.opts.Confirm(convs)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			LogEvent(LevelInfo, "not_confirmed", "Not confirmed, nothing was deleted")
+			return nil, nil
+		}
+	}
+
+	if c.opts.ReportPath != "" {
+		c.report, err = newReporter(c.opts.ReportPath)
+		if err != nil {
+			return nil, fmt.Errorf("creating report: %w", err)
+		}
+	}
+
+	workers := c.opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	if c.opts.Redact != "" {
+		LogEvent(LevelInfo, "redact_mode",
+			fmt.Sprintf("Redacting messages to %q instead of deleting them", c.opts.Redact), "text", c.opts.Redact)
+	}
+	res := &Result{
+		Convs:      convs,
+		Stats:      make([]ConvStats, len(convs)),
+		Identities: []Identity{{User: auth.User, UserID: auth.UserID, Team: auth.Team, TeamID: auth.TeamID}},
+	}
+	began := time.Now()
+	c.progress(Progress{Queued: len(convs)})
+	jobs := make(chan int)
+	feedCtx, stopFeed := context.WithCancel(ctx)
+	defer stopFeed()
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first := true
+			for i := range jobs {
+				if !first && c.opts.ChannelDelay > 0 {
+					if sleep(ctx, c.opts.ChannelDelay) != nil {
+						return
+					}
+				}
+				first = false
+				t0 := time.Now()
+				st, err := c.DeleteConversation(ctx, convs[i])
+				res.Stats[i] = st
+				c.notify(ctx, convs[i], st, time.Since(t0), err)
+				c.progress(Progress{Conv: convs[i], Deleted: st.Deleted, Total: st.total, Done: true})
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("channel %s: %w", convs[i], err))
+					mu.Unlock()
+					if c.opts.FailFast && ctx.Err() == nil {
+						LogEvent(LevelError, "fail_fast",
+							fmt.Sprintf("Cleaning channel %s failed, not starting on any others", convs[i]),
+							"channel", convs[i], "error", err.Error())
+						stopFeed()
+					}
+				}
+			}
+		}()
+	}
+feed:
+	for i := range convs {
+		if feedCtx.Err() != nil {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-feedCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	res.Elapsed = time.Since(began)
+
+	if err := c.report.close(); err != nil {
+		errs = append(errs, fmt.Errorf("writing report: %w", err))
+	}
+
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+
+	if len(errs) > 0 {
+		return res, errors.Join(errs...)
+	}
+
+	return res, nil
+}
+
+// Target is a conversation to clean, along with the config entry it was
+// resolved from.
+type Target struct {
+	// Entry is the conversation, user or comma separated mpim group as
+	// written in the config.
+	Entry string
+	// Conv is the conversation ID.
+	Conv string
+}
+
+// ResolveConversations returns a list of conversation ID, that are the
+// conversations in the config, followed by the conversation between the bot
+// and each user ID, then the multi-person DM of each mpim group.
+// Conversations given as #channel-name are resolved to their ID, and names
+// with a * in them are expanded to every matching channel. Protected
+// conversations are left out.
+func (c *Cleaner) ResolveConversations(ctx context.Context) ([]string, error) {
+	targets, err := c.ResolveTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	convs := make([]string, len(targets))
+	for i, t := range targets {
+		convs[i] = t.Conv
+	}
+	return convs, nil
+}
+
+// ResolveTargets is ResolveConversations, keeping the config entry each
+// conversation ID was resolved from.
+func (c *Cleaner) ResolveTargets(ctx context.Context) ([]Target, error) {
+
+	var targets []Target
+
+	channels := newChannelResolver(c.api, c.opts.RateLimitWait, c.config.Team)
+	for _, v := range c.config.Convs {
+
+		conv := v.Name
+		n := len(targets)
+		if strings.Contains(conv, "*") {
+			ids, err := channels.glob(ctx, conv)
+			if err != nil {
+				return nil, err
+			}
+			LogEvent(LevelInfo, "pattern_expanded", fmt.Sprintf("Channel pattern %s matched %d channels", conv, len(ids)),
+				"pattern", conv, "count", len(ids))
+			for _, id := range ids {
+				targets = append(targets, Target{Entry: conv, Conv: id})
+			}
+			c.setWindow(v, targets[n:])
+			continue
+		}
+
+		id := conv
+		if strings.HasPrefix(conv, "#") {
+			var err error
+			id, err = channels.resolve(ctx, conv)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		targets = append(targets, Target{Entry: conv, Conv: id})
+		c.setWindow(v, targets[n:])
+	}
+
+	for _, u := range c.config.Users {
+
+		conversation, err := getConvoFromUsers(ctx, c.api, u)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, Target{Entry: u, Conv: conversation})
+	}
+
+	for _, g := range c.config.MPIMs {
+
+		entry := strings.Join(g, ",")
+		conversation, err := getConvoFromUsers(ctx, c.api, g...)
+		if err != nil {
+			return nil, fmt.Errorf("mpim %s: %w", entry, err)
+		}
+
+		targets = append(targets, Target{Entry: entry, Conv: conversation})
+	}
+
+	for _, l := range c.config.Permalinks {
+
+		conv, _, err := parsePermalink(l)
+		if err != nil {
+			return nil, err
+		}
+		if hasTarget(targets, conv) {
+			continue
+		}
+
+		targets = append(targets, Target{Entry: "permalink", Conv: conv})
+	}
+
+	return c.unprotected(ctx, uniqueTargets(targets), channels)
+}
+
+// setWindow records the window of the config entry v for the targets it
+// resolved to, when it has one. Each bound it leaves unset is the one of
+// the config, and opts.OlderThan tightens it the same way.
+func (c *Cleaner) setWindow(v Conv, targets []Target) {
+	if v.before.IsZero() && v.after.IsZero() {
+		return
+	}
+	w := &window{before: c.config.before, after: c.config.after}
+	if !v.before.IsZero() {
+		w.before = v.before
+		if !c.olderThan.IsZero() && c.olderThan.Before(w.before) {
+			w.before = c.olderThan
+		}
+	}
+	if !v.after.IsZero() {
+		w.after = v.after
+	}
+	if c.windows == nil {
+		c.windows = make(map[string]*window)
+	}
+	for _, t := range targets {
+		c.windows[t.Conv] = w
+	}
+}
+
+// hasTarget reports whether conv is already one of targets.
+func hasTarget(targets []Target, conv string) bool {
+	for _, t := range targets {
+		if t.Conv == conv {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueTargets returns targets without the ones whose conversation an
+// earlier one already resolved to, such as a channel listed by ID that a
+// pattern also matched, so no conversation is cleaned twice at once.
+func uniqueTargets(targets []Target) []Target {
+	var kept []Target
+	for _, t := range targets {
+		if !hasTarget(kept, t.Conv) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// unprotected returns targets without the conversations in the config's
+// protected list. Protected conversations that were asked for by name or ID
+// are warned about, since the config contradicts itself there.
+func (c *Cleaner) unprotected(ctx context.Context, targets []Target, channels *channelResolver) ([]Target, error) {
+	if len(c.config.Protected) == 0 {
+		return targets, nil
+	}
+	protected := make(map[string]bool, len(c.config.Protected))
+	for _, p := range c.config.Protected {
+		id := p
+		if strings.HasPrefix(p, "#") {
+			var err error
+			id, err = channels.resolve(ctx, p)
+			if err != nil {
+				return nil, fmt.Errorf("protected: %w", err)
+			}
+		}
+		protected[id] = true
+	}
+	var kept []Target
+	for _, t := range targets {
+		if !protected[t.Conv] {
+			kept = append(kept, t)
+			continue
+		}
+		if t.Entry == t.Conv || strings.HasPrefix(t.Entry, "#") && !strings.Contains(t.Entry, "*") {
+			LogEvent(LevelWarn, "protected_conflict",
+				fmt.Sprintf("WARNING: channel %s is listed as %s but is also protected, it will NOT be cleaned", t.Conv, t.Entry),
+				"channel", t.Conv, "entry", t.Entry)
+			continue
+		}
+		LogEvent(LevelInfo, "protected_skip", fmt.Sprintf("Skipping protected channel %s from %s", t.Conv, t.Entry),
+			"channel", t.Conv, "entry", t.Entry)
+	}
+	return kept, nil
+}
+
+// getConvoFromUsers returns the channel ID of the DM with users, which are
+// either user IDs or the email addresses of workspace users. More than one
+// user opens a multi-person DM.
+func getConvoFromUsers(ctx context.Context, api API, users ...string) (string, error) {
+	ids := make([]string, len(users))
+	for i, user := range users {
+		if strings.Contains(user, "@") {
+			u, err := api.GetUserByEmailContext(ctx, user)
+			if err != nil {
+				return "", fmt.Errorf("no workspace user found with email %s: %w", user, err)
+			}
+			user = u.ID
+		}
+		ids[i] = user
+	}
+	conv, err := getChannelIDFromUsers(ctx, ids, api)
+	if err != nil {
+		return "", err
+	}
+	return conv, nil
+}
+
+// getChannelIDFromUsers will open a DM with the provided userIDs, and return the channel
+// ID so it can be used for sending messages. This is the same IM for an
+// assistant app, whose threads with the user are in it rather than a
+// conversation of their own.
+func getChannelIDFromUsers(ctx context.Context, userIDs []string, api API) (string, error) {
+	params := slack.OpenConversationParameters{
+		Users: userIDs,
+	}
+	channel, _, _, err := api.OpenConversationContext(ctx, &params)
+	if err != nil {
+		return "", err
+	}
+	if channel == nil || channel.ID == "" {
+		return "", fmt.Errorf("opening the DM with %s returned no channel", strings.Join(userIDs, ","))
+	}
+	return channel.ID, nil
+}
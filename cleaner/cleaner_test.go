@@ -0,0 +1,134 @@
+package cleaner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestGetChannelIDFromUsers(t *testing.T) {
+	api := newFakeAPI(0)
+	api.dms["U1"] = "D1"
+	api.dms["U1,U2"] = "G1"
+	api.dms["U3"] = ""
+	tests := []struct {
+		users   []string
+		want    string
+		wantErr bool
+	}{
+		{users: []string{"U1"}, want: "D1"},
+		{users: []string{"U1", "U2"}, want: "G1"},
+		// Opening a DM that comes back without a channel is an error
+		// rather than an empty conversation ID.
+		{users: []string{"U3"}, wantErr: true},
+		{users: []string{"U4"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := getChannelIDFromUsers(context.Background(), tt.users, api)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("getChannelIDFromUsers(%q) = %q, %v, want %q, error %v", tt.users, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRunCleansOpenedDM(t *testing.T) {
+	api := newFakeAPI(3, "D1", "D2")
+	api.dms["U1"] = "D1"
+	c, err := New(api, &Config{Token: "xoxb-test", Users: []string{"U1"}}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Convs, []string{"D1"}) {
+		t.Errorf("got conversations %q, want [D1]", res.Convs)
+	}
+	if _, ok := api.cursors["D1"]; !ok {
+		t.Error("the history of D1 was not read")
+	}
+	if len(api.deletes["D1"]) != 3 {
+		t.Errorf("got %d deletes in D1, want 3", len(api.deletes["D1"]))
+	}
+	if len(api.cursors["D2"]) != 0 || len(api.deletes["D2"]) != 0 {
+		t.Error("D2 was cleaned, though it is not the DM opened with U1")
+	}
+}
+
+func TestAssistantThreadReplies(t *testing.T) {
+	parent := fakeTimestamp(10)
+	api := newFakeAPI(0)
+	// An assistant thread parent has no reply count of its own, only its
+	// subtype tells it apart.
+	api.history["D1"] = []slack.Message{{Msg: slack.Msg{Timestamp: parent, SubType: assistantThread}}}
+	api.replies["D1/"+parent] = []slack.Message{
+		{Msg: slack.Msg{Timestamp: parent, ThreadTimestamp: parent, SubType: assistantThread}},
+		{Msg: slack.Msg{Timestamp: fakeTimestamp(11), ThreadTimestamp: parent}},
+		{Msg: slack.Msg{Timestamp: fakeTimestamp(12), ThreadTimestamp: parent}},
+	}
+	c := newTestCleaner(t, api, Options{}, "D1")
+
+	stats, err := c.DeleteConversation(context.Background(), "D1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(api.replyReads, []string{"D1/" + parent}) {
+		t.Errorf("got replies read of %q, want the thread of %s", api.replyReads, parent)
+	}
+	want := []string{fakeTimestamp(11), fakeTimestamp(12), parent}
+	if !reflect.DeepEqual(api.deletes["D1"], want) {
+		t.Errorf("got deletes %q, want %q", api.deletes["D1"], want)
+	}
+	if stats.Deleted != 3 {
+		t.Errorf("got %d deleted, want 3", stats.Deleted)
+	}
+}
+
+func TestRunConcurrencyKeepsChannelsSerial(t *testing.T) {
+	const n, pageSize = 25, 4
+	convs := []string{"C1", "C2", "C3", "C4", "C5"}
+	api := newFakeAPI(n, convs...)
+	api.pageSize = pageSize
+	api.deleteDelay = time.Millisecond
+	api.deleteErrs = []error{&slack.RateLimitedError{RetryAfter: time.Millisecond}}
+	c := newTestCleaner(t, api, Options{Concurrency: 3, MaxAttempts: 3}, convs...)
+
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wantDeletes, wantCursors []string
+	for i := n; i > 0; i-- {
+		wantDeletes = append(wantDeletes, fakeTimestamp(i))
+	}
+	wantCursors = append(wantCursors, "")
+	for i := pageSize; i < n; i += pageSize {
+		wantCursors = append(wantCursors, fakeTimestamp(n-i+1))
+	}
+	for i, conv := range convs {
+		if res.Stats[i].Deleted != n {
+			t.Errorf("%s: got %d deleted, want %d", conv, res.Stats[i].Deleted, n)
+		}
+		if !reflect.DeepEqual(api.deletes[conv], wantDeletes) {
+			t.Errorf("%s: got deletes %q, want them one at a time newest first %q", conv, api.deletes[conv], wantDeletes)
+		}
+		if !reflect.DeepEqual(api.cursors[conv], wantCursors) {
+			t.Errorf("%s: got cursors %q, want %q", conv, api.cursors[conv], wantCursors)
+		}
+	}
+	// One call was rate limited, every other deleted a message once.
+	if want := len(convs)*n + 1; api.deleteCalls != want {
+		t.Errorf("got %d delete calls, want %d", api.deleteCalls, want)
+	}
+	if api.overlaps > 0 {
+		t.Errorf("got %d deletes made while another was in flight in the same channel, want none", api.overlaps)
+	}
+	if api.maxInFlight < 2 {
+		t.Errorf("got at most %d deletes in flight at once, want the channels cleaned concurrently", api.maxInFlight)
+	}
+}
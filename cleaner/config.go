@@ -0,0 +1,714 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// maxMPIMUsers is the most users slack allows a multi-person DM to be opened
+// with, not counting the bot itself.
+const maxMPIMUsers = 8
+
+// TokenEnv is the environment variable checked for the api token when it is
+// not passed as a flag.
+const TokenEnv = "SLACK_BOT_TOKEN"
+
+// Config is the yaml settings file, describing which conversations to clean
+// and which of their messages to delete.
+type Config struct {
+	// Include is another settings file read first, which this one is merged
+	// into. A relative path is taken from the settings file it is in.
+	Include string `yaml:"include,omitempty"`
+	// Token is the api token, which may reference env vars as ${NAME}.
+	Token string `yaml:"apitoken,omitempty"`
+	// TokenFile is a file holding the api token, used when Token is empty.
+	// A relative path is taken from the settings file it is in.
+	TokenFile string   `yaml:"apitoken_file,omitempty"`
+	Convs     []Conv   `yaml:"conversation,omitempty"`
+	Users     []string `yaml:"userid,omitempty"`
+	// MPIMs are groups of users, each opened together as one multi-person
+	// DM with the bot.
+	MPIMs    [][]string `yaml:"mpim,omitempty"`
+	Before   string     `yaml:"before,omitempty"`
+	After    string     `yaml:"after,omitempty"`
+	OnlyUser string     `yaml:"onlyuser,omitempty"`
+	Match    string     `yaml:"match,omitempty"`
+	Subtypes Subtypes   `yaml:"subtypes,omitempty"`
+	// HasAttachments and HasBlocks, when set, only delete the messages that
+	// have attachments or Block Kit blocks when true, or that have none when
+	// false.
+	HasAttachments *bool `yaml:"has-attachments,omitempty"`
+	HasBlocks      *bool `yaml:"has-blocks,omitempty"`
+	// Team, on Enterprise Grid, is the workspace within the org that
+	// channel names and patterns are looked up in.
+	Team string `yaml:"team,omitempty"`
+	// Protected are conversations, by ID or #name, that are never cleaned
+	// whatever the other settings resolve to.
+	Protected []string `yaml:"protected,omitempty"`
+	// Timestamps, when set, are the only messages deleted, by their exact
+	// ts in each conversation, without paging through the history.
+	Timestamps []string `yaml:"timestamps,omitempty"`
+	// Permalinks are links to single messages to delete, each in the
+	// conversation it links to, without paging through the history.
+	Permalinks []string `yaml:"permalinks,omitempty"`
+	// Workspaces, when set, are cleaned one after the other, each with its
+	// own token and targets. The other settings at the top level apply to
+	// all of them, see Workspace.
+	Workspaces []Config `yaml:"workspaces,omitempty"`
+	// Webhook, when set, is posted a JSON summary of each conversation once
+	// it is done.
+	Webhook string `yaml:"webhook,omitempty"`
+
+	// RefreshToken, ClientID and ClientSecret, when set, are used by Refresh
+	// to rotate Token before it expires at TokenExpiry.
+	RefreshToken string `yaml:"refreshtoken,omitempty"`
+	ClientID     string `yaml:"clientid,omitempty"`
+	ClientSecret string `yaml:"clientsecret,omitempty"`
+	TokenExpiry  string `yaml:"tokenexpiry,omitempty"`
+
+	// before and after are the parsed Before and After bounds, zero when unset.
+	before time.Time
+	after  time.Time
+	// match is the compiled Match, nil when unset.
+	match *regexp.Regexp
+	// links are the timestamps of the Permalinks by conversation, in the
+	// order they were listed.
+	links map[string][]string
+	// refreshPath is the settings file RefreshToken came from, which is
+	// rewritten with the rotated tokens when tokenInFile is set, that is when
+	// the Token in use is written out in it, not an env var reference or
+	// from apitoken_file, the environment or the command line.
+	refreshPath string
+	tokenInFile bool
+	// tokenExpanded is set once Token needs no more env var expansion,
+	// because it was expanded already or does not come from yaml.
+	tokenExpanded bool
+}
+
+// Conv is a conversation to clean, by ID, #name or name pattern. In yaml it
+// is either just that, or an object that also has a before and after window
+// of its own for the conversation. Either bound falls back to the one of the
+// config when it is not set.
+type Conv struct {
+	Name   string `yaml:"channel"`
+	Before string `yaml:"before,omitempty"`
+	After  string `yaml:"after,omitempty"`
+
+	// before and after are the parsed Before and After, zero when unset.
+	before time.Time
+	after  time.Time
+}
+
+// Convs returns the conversations called names, without windows of their
+// own.
+func Convs(names ...string) []Conv {
+	convs := make([]Conv, len(names))
+	for i, n := range names {
+		convs[i].Name = n
+	}
+	return convs
+}
+
+// UnmarshalYAML decodes a Conv from either its name or an object.
+func (v *Conv) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*v = Conv{Name: name}
+		return nil
+	}
+	type plain Conv
+	return unmarshal((*plain)(v))
+}
+
+// MarshalYAML encodes a Conv as just its name when it has no window.
+func (v Conv) MarshalYAML() (interface{}, error) {
+	if v.Before == "" && v.After == "" {
+		return v.Name, nil
+	}
+	type plain Conv
+	return plain(v), nil
+}
+
+// names returns the names of convs.
+func names(convs []Conv) []string {
+	s := make([]string, len(convs))
+	for i, v := range convs {
+		s[i] = v.Name
+	}
+	return s
+}
+
+// Subtypes filters messages by their subtype, such as bot_message or
+// channel_join. When Include is set only messages with one of those subtypes
+// are deleted, which leaves out plain messages since they have none. Messages
+// with a subtype in Exclude are never deleted. Both empty deletes everything.
+type Subtypes struct {
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// ReadYmlFiles reads the configs at paths, merges them and validates the
+// result. The api token is taken from token if set, then the SLACK_BOT_TOKEN
+// env var, then the files themselves.
+func ReadYmlFiles(paths []string, token string) (*Config, error) {
+	return ReadYmlFilesWith(paths, token, Targets{})
+}
+
+// Targets are conversations and users that replace those of the settings
+// files, for cleaning a few of them without editing the files.
+type Targets struct {
+	Convs      []string
+	Users      []string
+	Permalinks []string
+	// ExtraUsers are added to the users of the files instead of replacing
+	// them, such as those of a targets file.
+	ExtraUsers []string
+}
+
+// ReadYmlFilesWith is ReadYmlFiles, except that when only has any
+// conversations, users or permalinks they are the only ones cleaned. The
+// targets of the files are all dropped then, and the ones of only are
+// validated the same as if they were in the files. The ExtraUsers of only
+// are added either way, leaving out the ones already there.
+func ReadYmlFilesWith(paths []string, token string, only Targets) (*Config, error) {
+	var c Config
+	stdin := false
+	for _, p := range paths {
+		if p == Stdin {
+			if stdin {
+				return nil, fmt.Errorf("stdin can only be read once")
+			}
+			stdin = true
+		}
+		f, err := ReadYmlFile(p)
+		if err != nil {
+			return nil, err
+		}
+		err = c.merge(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	if len(only.Convs) > 0 || len(only.Users) > 0 || len(only.Permalinks) > 0 {
+		c.Convs = Convs(only.Convs...)
+		c.Users = only.Users
+		c.MPIMs = nil
+		c.Permalinks = only.Permalinks
+		c.Workspaces = nil
+	}
+	c.Users = appendUnique(c.Users, only.ExtraUsers...)
+	if token != "" {
+		c.Token, c.tokenInFile, c.tokenExpanded = token, false, true
+	} else if env := os.Getenv(TokenEnv); env != "" {
+		c.Token, c.tokenInFile, c.tokenExpanded = env, false, true
+	}
+	return ValidateYmlFile(&c)
+}
+
+// Stdin is the settings file path that reads the config from stdin.
+const Stdin = "-"
+
+// ReadYmlFile reads the config at p, or from stdin when p is Stdin, without
+// validating it. When it includes another file, that one is read first and
+// p is merged into it, following includes of includes.
+func ReadYmlFile(p string) (*Config, error) {
+	return readYmlFile(p, nil)
+}
+
+// readYmlFile is ReadYmlFile for a file included by the chain of files
+// before it, which it must not include again.
+func readYmlFile(p string, chain []string) (*Config, error) {
+	var b []byte
+	var err error
+	if p == Stdin {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	err = yaml.Unmarshal(b, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if c.TokenFile != "" && !filepath.IsAbs(c.TokenFile) {
+		c.TokenFile = filepath.Join(filepath.Dir(p), c.TokenFile)
+	}
+	for i := range c.Workspaces {
+		w := &c.Workspaces[i]
+		if w.TokenFile != "" && !filepath.IsAbs(w.TokenFile) {
+			w.TokenFile = filepath.Join(filepath.Dir(p), w.TokenFile)
+		}
+	}
+	if c.RefreshToken != "" && p != Stdin {
+		c.refreshPath = p
+		c.tokenInFile = c.Token != "" && !strings.Contains(c.Token, "$")
+	}
+	if c.Include == "" {
+		return &c, nil
+	}
+	inc := c.Include
+	if !filepath.IsAbs(inc) {
+		inc = filepath.Join(filepath.Dir(p), inc)
+	}
+	abs, err := filepath.Abs(inc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if p != Stdin && len(chain) == 0 {
+		self, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		chain = []string{self}
+	}
+	if contains(chain, abs) {
+		return nil, fmt.Errorf("%s: circular include of %s", p, c.Include)
+	}
+	base, err := readYmlFile(inc, append(chain, abs))
+	if err != nil {
+		return nil, err
+	}
+	err = base.merge(&c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return base, nil
+}
+
+// merge adds the conversations and users of o to c, skipping any already
+// there. The other settings are taken from whichever config sets them, and it
+// is an error for both to set them to different values.
+func (c *Config) merge(o *Config) error {
+	for _, v := range o.Convs {
+		if !contains(names(c.Convs), v.Name) {
+			c.Convs = append(c.Convs, v)
+		}
+	}
+	c.Users = appendUnique(c.Users, o.Users...)
+	c.MPIMs = appendUniqueGroups(c.MPIMs, o.MPIMs...)
+	c.Subtypes.Include = appendUnique(c.Subtypes.Include, o.Subtypes.Include...)
+	c.Subtypes.Exclude = appendUnique(c.Subtypes.Exclude, o.Subtypes.Exclude...)
+	c.Timestamps = appendUnique(c.Timestamps, o.Timestamps...)
+	c.Permalinks = appendUnique(c.Permalinks, o.Permalinks...)
+	c.Workspaces = append(c.Workspaces, o.Workspaces...)
+	c.Protected = appendUnique(c.Protected, o.Protected...)
+	if o.refreshPath != "" {
+		c.refreshPath, c.tokenInFile = o.refreshPath, o.tokenInFile
+	}
+	fields := []struct {
+		name     string
+		dst, src *string
+	}{
+		{"apitoken", &c.Token, &o.Token},
+		{"apitoken_file", &c.TokenFile, &o.TokenFile},
+		{"before", &c.Before, &o.Before},
+		{"after", &c.After, &o.After},
+		{"onlyuser", &c.OnlyUser, &o.OnlyUser},
+		{"match", &c.Match, &o.Match},
+		{"team", &c.Team, &o.Team},
+		{"webhook", &c.Webhook, &o.Webhook},
+		{"refreshtoken", &c.RefreshToken, &o.RefreshToken},
+		{"clientid", &c.ClientID, &o.ClientID},
+		{"clientsecret", &c.ClientSecret, &o.ClientSecret},
+		{"tokenexpiry", &c.TokenExpiry, &o.TokenExpiry},
+	}
+	for _, f := range fields {
+		if *f.src == "" {
+			continue
+		}
+		if *f.dst != "" && *f.dst != *f.src {
+			return fmt.Errorf("conflicting %s with an earlier settings file", f.name)
+		}
+		*f.dst = *f.src
+	}
+	flags := []struct {
+		name     string
+		dst, src **bool
+	}{
+		{"has-attachments", &c.HasAttachments, &o.HasAttachments},
+		{"has-blocks", &c.HasBlocks, &o.HasBlocks},
+	}
+	for _, f := range flags {
+		if *f.src == nil {
+			continue
+		}
+		if *f.dst != nil && **f.dst != **f.src {
+			return fmt.Errorf("conflicting %s with an earlier settings file", f.name)
+		}
+		*f.dst = *f.src
+	}
+	return nil
+}
+
+// appendUnique appends the values of add to s that are not already in it.
+// Repeats within add itself are kept, so ValidateYmlFile can report them.
+func appendUnique(s []string, add ...string) []string {
+	seen := make(map[string]bool, len(s))
+	for _, v := range s {
+		seen[v] = true
+	}
+	for _, v := range add {
+		if !seen[v] {
+			s = append(s, v)
+		}
+	}
+	return s
+}
+
+// appendUniqueGroups is appendUnique for groups of users, where two groups
+// are the same if they have the same users in the same order.
+func appendUniqueGroups(s [][]string, add ...[]string) [][]string {
+	seen := make(map[string]bool, len(s))
+	for _, g := range s {
+		seen[strings.Join(g, ",")] = true
+	}
+	for _, g := range add {
+		if !seen[strings.Join(g, ",")] {
+			s = append(s, g)
+		}
+	}
+	return s
+}
+
+// ValidateYmlFile will validate the config. Every problem found is returned
+// together in a ConfigError, so they can all be fixed in one pass.
+func ValidateYmlFile(c *Config) (*Config, error) {
+	var errs []error
+	if err := c.resolveToken(); err != nil {
+		errs = append(errs, err)
+	}
+	refresh := c.RefreshToken != "" || c.ClientID != "" || c.ClientSecret != ""
+	if c.Token == "" && !refresh && len(c.Workspaces) == 0 {
+		errs = append(errs, ErrInvalidToken)
+	}
+	if refresh && (c.RefreshToken == "" || c.ClientID == "" || c.ClientSecret == "") {
+		errs = append(errs, fmt.Errorf("refreshtoken, clientid and clientsecret must be set together"))
+	}
+	if c.TokenExpiry != "" {
+		if _, err := time.Parse(time.RFC3339, c.TokenExpiry); err != nil {
+			errs = append(errs, fmt.Errorf("invalid tokenexpiry: %w", err))
+		}
+	}
+	if len(c.Users) == 0 && len(c.Convs) == 0 && len(c.MPIMs) == 0 && len(c.Permalinks) == 0 && len(c.Workspaces) == 0 {
+		errs = append(errs, ErrNoTargets)
+	}
+	errs = append(errs, checkEntries("userid", c.Users, validUser)...)
+	for i, g := range c.MPIMs {
+		if len(g) < 2 || len(g) > maxMPIMUsers {
+			errs = append(errs, fmt.Errorf("mpim %d needs between 2 and %d users, has %d", i+1, maxMPIMUsers, len(g)))
+		}
+		errs = append(errs, checkEntries(fmt.Sprintf("mpim %d user", i+1), g, validUser)...)
+	}
+	errs = append(errs, checkEntries("conversation", names(c.Convs), validConv)...)
+	errs = append(errs, checkEntries("subtypes include", c.Subtypes.Include, validSubtype)...)
+	errs = append(errs, checkEntries("subtypes exclude", c.Subtypes.Exclude, validSubtype)...)
+	if c.Team != "" && !isSlackID(c.Team, "T") {
+		errs = append(errs, fmt.Errorf("%w: malformed team %q", ErrInvalidEntry, c.Team))
+	}
+	errs = append(errs, checkEntries("protected", c.Protected, validProtected)...)
+	errs = append(errs, checkEntries("timestamp", c.Timestamps, validTimestamp)...)
+	// Malformed permalinks are reported by compile.
+	errs = append(errs, checkEntries("permalink", c.Permalinks, func(string) bool { return true })...)
+	if c.Webhook != "" && !validWebhook(c.Webhook) {
+		errs = append(errs, fmt.Errorf("%w: malformed webhook %q, want an http or https URL", ErrInvalidEntry, c.Webhook))
+	}
+	for _, s := range c.Subtypes.Include {
+		if contains(c.Subtypes.Exclude, s) {
+			errs = append(errs, fmt.Errorf("subtype %q is both included and excluded", s))
+		}
+	}
+	if err := c.compile(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.Workspaces) > 0 && (len(c.Users) > 0 || len(c.Convs) > 0 || len(c.MPIMs) > 0 || len(c.Permalinks) > 0) {
+		errs = append(errs, fmt.Errorf("with workspaces, the conversations and users to clean go in each workspace"))
+	}
+	for i := range c.Workspaces {
+		_, err := c.Workspace(i)
+		var cerr *ConfigError
+		if errors.As(err, &cerr) {
+			for _, e := range cerr.Errs {
+				errs = append(errs, fmt.Errorf("workspace %d: %w", i+1, e))
+			}
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("workspace %d: %w", i+1, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ConfigError{Errs: errs}
+	}
+	return c, nil
+}
+
+// Workspace returns the validated config of the i'th of c.Workspaces. It has
+// the token and targets of the workspace, falling back to the token of c
+// when it has none, along with the filters and other settings of c. A
+// workspace can set those too, as long as it does not conflict with c.
+// Rotating tokens are only supported at the top level.
+func (c *Config) Workspace(i int) (*Config, error) {
+	ws := c.Workspaces[i]
+	if ws.RefreshToken != "" || ws.ClientID != "" || ws.ClientSecret != "" || len(ws.Workspaces) > 0 {
+		return nil, fmt.Errorf("refresh tokens and nested workspaces are only supported at the top level")
+	}
+	w := Config{
+		Token:     c.Token,
+		TokenFile: c.TokenFile,
+		Before:    c.Before,
+		After:     c.After,
+		OnlyUser:  c.OnlyUser,
+		Match:     c.Match,
+		Subtypes: Subtypes{
+			Include: append([]string(nil), c.Subtypes.Include...),
+			Exclude: append([]string(nil), c.Subtypes.Exclude...),
+		},
+		HasAttachments: c.HasAttachments,
+		HasBlocks:      c.HasBlocks,
+		Team:           c.Team,
+		Protected:      append([]string(nil), c.Protected...),
+		Timestamps:     append([]string(nil), c.Timestamps...),
+		Webhook:        c.Webhook,
+		tokenExpanded:  c.tokenExpanded,
+	}
+	if ws.Token != "" || ws.TokenFile != "" {
+		w.Token, w.TokenFile, w.tokenExpanded = "", "", false
+	}
+	if ws.Team != "" {
+		// The top level team is from another workspace.
+		w.Team = ""
+	}
+	err := w.merge(&ws)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateYmlFile(&w)
+}
+
+// PerWorkspace returns the config of each of c.Workspaces, or just c when it
+// has none.
+func (c *Config) PerWorkspace() ([]*Config, error) {
+	if len(c.Workspaces) == 0 {
+		return []*Config{c}, nil
+	}
+	configs := make([]*Config, len(c.Workspaces))
+	for i := range c.Workspaces {
+		w, err := c.Workspace(i)
+		if err != nil {
+			return nil, fmt.Errorf("workspace %d: %w", i+1, err)
+		}
+		configs[i] = w
+	}
+	return configs, nil
+}
+
+// resolveToken expands the ${NAME} env var references in Token, unless it
+// did not come from yaml or was expanded already, and reads it from
+// TokenFile when it is empty.
+func (c *Config) resolveToken() error {
+	if !c.tokenExpanded {
+		var missing []string
+		c.Token = os.Expand(c.Token, func(name string) string {
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return v
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("apitoken references unset env vars %s", strings.Join(missing, ", "))
+		}
+		c.tokenExpanded = true
+	}
+	if c.Token != "" || c.TokenFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		return fmt.Errorf("reading apitoken_file: %w", err)
+	}
+	c.Token = strings.TrimSpace(string(b))
+	if c.Token == "" {
+		return fmt.Errorf("apitoken_file %s is empty", c.TokenFile)
+	}
+	return nil
+}
+
+// compile parses the before/after bounds and the match pattern of the config
+// into the form the filters use.
+func (c *Config) compile() error {
+	var errs []error
+	now := time.Now()
+	var err error
+	c.before, c.after, c.match, c.links = time.Time{}, time.Time{}, nil, nil
+	for _, l := range c.Permalinks {
+		conv, ts, err := parsePermalink(l)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidEntry, err))
+			continue
+		}
+		if c.links == nil {
+			c.links = make(map[string][]string)
+		}
+		c.links[conv] = append(c.links[conv], ts)
+	}
+	if c.Before != "" {
+		c.before, err = parseTimeBound(c.Before, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid before: %w", err))
+		}
+	}
+	if c.After != "" {
+		c.after, err = parseTimeBound(c.After, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid after: %w", err))
+		}
+	}
+	if c.Match != "" {
+		c.match, err = regexp.Compile(c.Match)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid match: %w", err))
+		}
+	}
+	for i := range c.Convs {
+		v := &c.Convs[i]
+		v.before, v.after = time.Time{}, time.Time{}
+		if v.Before != "" {
+			v.before, err = parseTimeBound(v.Before, now)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid before of conversation %s: %w", v.Name, err))
+			}
+		}
+		if v.After != "" {
+			v.after, err = parseTimeBound(v.After, now)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid after of conversation %s: %w", v.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkEntries returns an error for every entry of the list called name that
+// is repeated, or that valid rejects.
+func checkEntries(name string, entries []string, valid func(string) bool) []error {
+	var errs []error
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if seen[e] {
+			errs = append(errs, fmt.Errorf("%w: duplicate %s %q", ErrInvalidEntry, name, e))
+			continue
+		}
+		seen[e] = true
+		if !valid(e) {
+			errs = append(errs, fmt.Errorf("%w: malformed %s %q", ErrInvalidEntry, name, e))
+		}
+	}
+	return errs
+}
+
+// validUser reports whether s looks like a slack user ID, which start with U
+// or W, or an email address.
+func validUser(s string) bool {
+	if strings.Contains(s, "@") {
+		return true
+	}
+	return isSlackID(s, "UW")
+}
+
+// validConv reports whether s looks like a slack conversation ID, which start
+// with C, D or G, a #channel-name, or a channel name pattern using *.
+func validConv(s string) bool {
+	if strings.Contains(s, "*") {
+		_, err := path.Match(s, "")
+		return err == nil
+	}
+	if strings.HasPrefix(s, "#") {
+		return len(s) > 1
+	}
+	return isSlackID(s, "CDG")
+}
+
+// validSubtype reports whether s looks like a slack message subtype, which
+// are lower case words joined by underscores.
+func validSubtype(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// validProtected reports whether s is a conversation ID or #channel-name a
+// protected entry can be, which unlike validConv rules out patterns.
+func validProtected(s string) bool {
+	return !strings.Contains(s, "*") && validConv(s)
+}
+
+// validTimestamp reports whether s looks like a slack message timestamp, such
+// as 1612345678.000200.
+func validTimestamp(s string) bool {
+	_, err := parseTimestamp(s)
+	return err == nil && strings.Count(s, ".") == 1
+}
+
+// ReadTimestamps reads the message timestamps in the file at p, one per line.
+// Blank lines are skipped.
+func ReadTimestamps(p string) ([]string, error) {
+	return readLines(p)
+}
+
+// readLines returns the lines of the file at p, trimmed, without the blank
+// ones.
+func readLines(p string) ([]string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// contains reports whether s is one of list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isSlackID reports whether s is an upper case alphanumeric ID starting with
+// one of the letters in prefixes.
+func isSlackID(s string, prefixes string) bool {
+	if len(s) < 2 || !strings.ContainsRune(prefixes, rune(s[0])) {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenOverrideNotExpanded(t *testing.T) {
+	t.Setenv("TEST_SLACK_TOKEN", "xoxb-env")
+	p := filepath.Join(t.TempDir(), "settings.yml")
+	if err := os.WriteFile(p, []byte("apitoken: ${TEST_SLACK_TOKEN}\nuserid: [U1]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, token, env, want string
+	}{
+		{"from yaml", "", "", "xoxb-env"},
+		{"from the flag", "xoxb-$TEST_SLACK_TOKEN", "", "xoxb-$TEST_SLACK_TOKEN"},
+		{"from the env", "", "xoxb-${TEST_SLACK_TOKEN}", "xoxb-${TEST_SLACK_TOKEN}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(TokenEnv, tt.env)
+			c, err := ReadYmlFiles([]string{p}, tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Token != tt.want {
+				t.Errorf("got token %q, want %q", c.Token, tt.want)
+			}
+		})
+	}
+}
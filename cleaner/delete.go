@@ -0,0 +1,772 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// errMaxMessages stops the cleaning of a conversation once MaxMessages have
+// been deleted from it.
+var errMaxMessages = errors.New("max messages reached")
+
+// historyStart is the oldest bound an oldest first walk starts from. Slack
+// takes an oldest of 0 as unset and would return the newest messages.
+const historyStart = "1.000000"
+
+// undeletableErrors are the slack api errors for a message the token can not
+// delete, which skip that message rather than stopping the run.
+var undeletableErrors = map[string]bool{
+	"cant_delete_message": true,
+	// The same for editing a message with opts.Redact.
+	"cant_update_message": true,
+	"edit_window_closed":  true,
+}
+
+// DeleteConversation will delete the all history of the conversation conv
+// within the config's before/after window and by the config's onlyuser if
+// set, and return the stats of what it did. When opts.DryRun is set the
+// messages are only logged, and when opts.ExportDir is set each page is
+// exported before anything in it is deleted. The history is paged through
+// with the cursor slack returns, so every message is read once whether or
+// not it was deleted. With opts.OldestFirst the history is walked forward
+// from the oldest message instead. A conversation that does not exist or
+// that the bot is not a member of is skipped with its reason in
+// stats.Unavailable, as is an archived one unless opts.Unarchive is set, see
+// unarchive.
+//
+// conv can be a public channel (C), a private channel (G, or C on newer
+// workspaces), a DM (D) or a multi-person DM (G), as long as the bot is a
+// member and the token has the matching history scope. For a bot token the
+// DM with a user is the Messages tab of its App Home, see flagAppHome. Any
+// other kind of conversation slack has no history for is skipped as well.
+//
+// When the config lists timestamps only those messages are deleted, see
+// deleteTimestamps, and the same goes for a conv that permalinks point into.
+// With opts.IncludeScheduled the messages still waiting to be posted are
+// deleted as well, see deleteScheduled, and with opts.ClearBookmarks its
+// bookmarks are removed, see clearBookmarks.
+func (c *Cleaner) DeleteConversation(ctx context.Context, conv string) (stats ConvStats, err error) {
+	stats.window = c.windows[conv]
+	info, err := c.conversationInfo(ctx, conv)
+	if _, ok := isUnavailable(err); ok {
+		// Left for the history call below to report.
+		err = nil
+	}
+	if err != nil {
+		stats.Errors++
+		return stats, fmt.Errorf("getting conversation info: %w", err)
+	}
+	c.flagShared(conv, info, &stats)
+	c.flagAppHome(conv, info)
+	rearchive, err := c.unarchive(ctx, conv, info, &stats)
+	if err != nil {
+		stats.Errors++
+		return stats, err
+	}
+	defer rearchive()
+	if stats.Unavailable != "" {
+		return stats, nil
+	}
+	if ts := c.config.links[conv]; len(ts) > 0 {
+		return c.deleteTimestamps(ctx, conv, ts)
+	}
+	if len(c.config.Timestamps) > 0 {
+		return c.deleteTimestamps(ctx, conv, c.config.Timestamps)
+	}
+	params := slack.GetConversationHistoryParameters{
+		ChannelID: conv,
+		Cursor:    c.checkpoint.get(conv).Cursor,
+		Limit:     c.opts.PageSize,
+	}
+	if last := c.state.latest(conv); last != "" {
+		params.Oldest = last
+		LogEvent(LevelInfo, "since_last_run", fmt.Sprintf("Only reading messages in channel %s since the last run", conv),
+			"channel", conv, "oldest", last)
+	}
+	if c.opts.OldestFirst {
+		params.Cursor = ""
+		if oldest := c.checkpoint.get(conv).Oldest; oldest != "" {
+			params.Oldest = oldest
+			LogEvent(LevelInfo, "resume", fmt.Sprintf("Resuming channel %s from checkpoint", conv),
+				"channel", conv, "oldest", params.Oldest)
+		} else if params.Oldest == "" {
+			params.Oldest = historyStart
+		}
+	}
+	if params.Cursor != "" {
+		LogEvent(LevelInfo, "resume", fmt.Sprintf("Resuming channel %s from checkpoint", conv),
+			"channel", conv, "cursor", params.Cursor)
+	}
+	var exp *exporter
+	if c.opts.ExportDir != "" {
+		cp := c.checkpoint.get(conv)
+		exp, err = newExporter(c.opts.ExportDir, conv, cp.Cursor != "" || cp.Oldest != "")
+		if err != nil {
+			return stats, err
+		}
+		defer func() {
+			cerr := exp.close()
+			if err == nil {
+				err = cerr
+			}
+		}()
+	}
+	if c.opts.KeepPinned {
+		stats.pinned, err = c.pinnedMessages(ctx, conv)
+		if _, ok := isUnavailable(err); ok {
+			// Left for the history call below to report.
+			err = nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("listing pins: %w", err)
+		}
+	}
+	began := time.Now()
+	stats.began = began
+	if c.opts.Estimate && !c.opts.DryRun {
+		stats.total, err = c.countMatching(ctx, conv, stats.pinned)
+		if _, ok := isUnavailable(err); ok {
+			// Left for the history call below to report.
+			err = nil
+		}
+		if err != nil {
+			return stats, err
+		}
+		LogEvent(LevelInfo, "estimate", fmt.Sprintf("Found about %d messages to delete in channel %s", stats.total, conv),
+			"channel", conv, "count", stats.total)
+	}
+	c.progress(Progress{Conv: conv, Total: stats.total})
+	defer func() {
+		if err != nil {
+			stats.Errors++
+		}
+		if err == nil && !c.opts.DryRun && stats.Unavailable == "" {
+			elapsed := time.Since(began).Round(time.Second)
+			LogEvent(LevelInfo, "channel_done",
+				fmt.Sprintf("Deleted %d messages in channel %s in %s", stats.Deleted, conv, elapsed),
+				"channel", conv, "count", stats.Deleted, "elapsed", elapsed.String())
+		}
+	}()
+	defer func() {
+		if stats.OtherAuthor > 0 {
+			LogEvent(LevelInfo, "author_skipped",
+				fmt.Sprintf("Skipped %d messages in channel %s not posted by %s", stats.OtherAuthor, conv, c.config.OnlyUser),
+				"channel", conv, "count", stats.OtherAuthor)
+		}
+		if stats.Pinned > 0 {
+			LogEvent(LevelInfo, "pinned_skipped",
+				fmt.Sprintf("Kept %d pinned messages in channel %s", stats.Pinned, conv),
+				"channel", conv, "count", stats.Pinned)
+		}
+		if stats.OtherReactions > 0 {
+			LogEvent(LevelInfo, "reactions_skipped",
+				fmt.Sprintf("Skipped %d messages in channel %s left out by their reactions", stats.OtherReactions, conv),
+				"channel", conv, "count", stats.OtherReactions)
+		}
+		if stats.OtherContent > 0 {
+			LogEvent(LevelInfo, "content_skipped",
+				fmt.Sprintf("Skipped %d messages in channel %s left out by the has-attachments or has-blocks filter", stats.OtherContent, conv),
+				"channel", conv, "count", stats.OtherContent)
+		}
+		if stats.OtherSubtype > 0 {
+			LogEvent(LevelInfo, "subtype_skipped",
+				fmt.Sprintf("Skipped %d messages in channel %s left out by the subtypes filter", stats.OtherSubtype, conv),
+				"channel", conv, "count", stats.OtherSubtype)
+		}
+		if c.config.match != nil {
+			LogEvent(LevelInfo, "match_summary",
+				fmt.Sprintf("Matched %d messages in channel %s, skipped %d not matching %s", stats.Deleted, conv, stats.NoMatch, c.config.Match),
+				"channel", conv, "count", stats.Deleted, "skipped", stats.NoMatch)
+		}
+	}()
+	defer func() {
+		if errors.Is(err, errMaxMessages) {
+			LogEvent(LevelInfo, "max_messages",
+				fmt.Sprintf("Reached the limit of %d messages in channel %s, stopping", c.opts.MaxMessages, conv),
+				"channel", conv, "count", stats.Deleted)
+			err = nil
+		}
+	}()
+	for {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		callCtx, cancel := callContext(ctx)
+		hist, err := c.api.GetConversationHistoryContext(callCtx, &params)
+		cancel()
+		if wait, ok := c.rateLimitWait(err); ok {
+			stats.RateLimits++
+			LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+				"channel", conv, "wait", wait.String())
+			err = sleep(ctx, wait)
+			if err != nil {
+				return stats, err
+			}
+			continue
+		}
+		if reason, ok := isUnavailable(err); ok {
+			stats.Unavailable = reason
+			LogEvent(LevelWarn, "channel_skipped",
+				fmt.Sprintf("Skipping channel %s, it can not be read: %s", conv, reason),
+				"channel", conv, "error", reason)
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+		if exp != nil {
+			err = exp.write(hist.Messages)
+			if err != nil {
+				return stats, err
+			}
+		}
+		if len(hist.Messages) == 0 {
+			break
+		}
+		stats.seen += len(hist.Messages)
+		deleted := stats.Deleted
+		msgs := hist.Messages
+		if c.opts.OldestFirst {
+			// Each page is still newest first, so it is walked backwards.
+			msgs = make([]slack.Message, len(hist.Messages))
+			for i, m := range hist.Messages {
+				msgs[len(msgs)-1-i] = m
+			}
+		}
+		for _, m := range msgs {
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+			stats.reached = m.Timestamp
+			// A message the before bound kept can still age into the
+			// window, so only those inside it move SinceLastRun on.
+			if in, _ := inWindow(m.Timestamp, c.windowOf(&stats)); in && newerTimestamp(m.Timestamp, stats.latest) {
+				stats.latest = m.Timestamp
+			}
+			if !c.opts.SkipThreads && isThreadParent(m) {
+				err = c.deleteReplies(ctx, conv, m.Timestamp, &stats)
+				if err != nil {
+					return stats, err
+				}
+			}
+			ok, err := c.shouldDelete(m, &stats)
+			if err != nil {
+				return stats, err
+			}
+			if !ok {
+				continue
+			}
+			err = c.removeMessage(ctx, conv, m, &stats)
+			if err != nil {
+				return stats, err
+			}
+		}
+		c.logPage(conv, stats.Deleted-deleted, &stats)
+		if c.opts.OldestFirst {
+			if !hist.HasMore {
+				break
+			}
+			// With only oldest set, slack returns the page just after it,
+			// so moving it past this page walks the history forward.
+			params.Oldest = hist.Messages[0].Timestamp
+			if !c.opts.DryRun {
+				err = c.checkpoint.save(conv, channelCheckpoint{Oldest: params.Oldest})
+				if err != nil {
+					return stats, err
+				}
+			}
+			continue
+		}
+		// The cursor points just past this page whether or not its
+		// messages were deleted, so the next page is always asked for with
+		// it rather than from the start again.
+		if !hist.HasMore || hist.ResponseMetaData.NextCursor == "" {
+			break
+		}
+		params.Cursor = hist.ResponseMetaData.NextCursor
+		stats.cursor = params.Cursor
+		if !c.opts.DryRun {
+			err = c.checkpoint.save(conv, channelCheckpoint{Cursor: params.Cursor})
+			if err != nil {
+				return stats, err
+			}
+		}
+	}
+	c.logCleared(conv, &stats)
+	c.reconcile(conv, &stats)
+	if c.opts.IncludeScheduled {
+		err = c.deleteScheduled(ctx, conv, &stats)
+		if err != nil {
+			return stats, err
+		}
+	}
+	if c.opts.ClearBookmarks {
+		err = c.clearBookmarks(ctx, conv, &stats)
+		if err != nil {
+			return stats, err
+		}
+	}
+	if c.opts.Verify && !c.opts.DryRun {
+		err = c.verify(ctx, conv, &stats)
+		if err != nil {
+			return stats, err
+		}
+	}
+	if !c.opts.DryRun {
+		err = c.checkpoint.save(conv, channelCheckpoint{Done: true})
+		if err != nil {
+			return stats, err
+		}
+		err = c.state.save(conv, stats.latest)
+		if err != nil {
+			return stats, fmt.Errorf("saving state: %w", err)
+		}
+	}
+	stats.done = true
+	return stats, nil
+}
+
+// logCleared logs how the history of conv ended up, telling a conversation
+// that was already empty, or had nothing that passed the filters, apart from
+// one that messages were deleted from.
+func (c *Cleaner) logCleared(conv string, stats *ConvStats) {
+	switch {
+	case stats.seen == 0 && c.state.latest(conv) != "":
+		LogEvent(LevelInfo, "channel_empty", fmt.Sprintf("No new messages in channel %s since the last run", conv),
+			"channel", conv)
+	case stats.seen == 0:
+		LogEvent(LevelInfo, "channel_empty", fmt.Sprintf("Channel %s is already empty, nothing to delete", conv),
+			"channel", conv)
+	case stats.Deleted == 0:
+		LogEvent(LevelInfo, "channel_unchanged",
+			fmt.Sprintf("Nothing to delete in channel %s, none of its %d messages passed the filters", conv, stats.seen),
+			"channel", conv, "count", stats.seen)
+	default:
+		LogEvent(LevelInfo, "channel_cleared", fmt.Sprintf("All messages cleared for channel: %s", conv),
+			"channel", conv)
+	}
+}
+
+// reconcile checks that every message read from the history of conv, thread
+// replies included, was counted as deleted, skipped, denied or already
+// deleted exactly once, and warns with the difference in stats.Unaccounted
+// when not.
+func (c *Cleaner) reconcile(conv string, stats *ConvStats) {
+	read := stats.seen + stats.replies
+	counted := stats.Deleted + stats.Skipped + stats.Denied + stats.AlreadyDeleted
+	stats.Unaccounted = read - counted
+	if stats.Unaccounted == 0 {
+		return
+	}
+	LogEvent(LevelWarn, "counts_mismatch",
+		fmt.Sprintf("Read %d messages in channel %s but counted %d as deleted, skipped, denied or already deleted", read, conv, counted),
+		"channel", conv, "read", read, "counted", counted)
+}
+
+// verbose reports whether every single message removed is logged, which
+// happens at the debug level.
+func (c *Cleaner) verbose() bool {
+	return !c.opts.Quiet && LogLevelEnabled(LevelDebug)
+}
+
+// logPage logs the n messages deleted from a page of the history of conv,
+// along with the running total, unless opts.Quiet is set.
+func (c *Cleaner) logPage(conv string, n int, stats *ConvStats) {
+	if c.opts.Quiet || n == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Deleted %d messages from %s, %d total", n, conv, stats.Deleted)
+	if c.opts.DryRun {
+		msg = fmt.Sprintf("Dry run: would delete %d messages from %s, %d total", n, conv, stats.Deleted)
+	}
+	LogEvent(LevelInfo, "page_done", msg, "channel", conv, "count", n, "total", stats.Deleted)
+}
+
+// deleteTimestamps deletes the messages at timestamps in conv, without
+// reading its history. The filters are not applied since the messages are
+// never fetched, and a timestamp that is not in conv is counted as already
+// deleted.
+func (c *Cleaner) deleteTimestamps(ctx context.Context, conv string, timestamps []string) (stats ConvStats, err error) {
+	for _, ts := range timestamps {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		err = c.removeMessage(ctx, conv, slack.Message{Msg: slack.Msg{Timestamp: ts}}, &stats)
+		if errors.Is(err, errMaxMessages) {
+			return stats, nil
+		}
+		if err != nil {
+			stats.Errors++
+			return stats, err
+		}
+	}
+	if !c.opts.DryRun {
+		LogEvent(LevelInfo, "channel_done",
+			fmt.Sprintf("Deleted %d of %d listed messages in channel %s", stats.Deleted, len(timestamps), conv),
+			"channel", conv, "count", stats.Deleted)
+	}
+	return stats, nil
+}
+
+// pinnedMessages returns the timestamps of the messages pinned in conv.
+func (c *Cleaner) pinnedMessages(ctx context.Context, conv string) (map[string]bool, error) {
+	for {
+		callCtx, cancel := callContext(ctx)
+		items, _, err := c.api.ListPinsContext(callCtx, conv)
+		cancel()
+		if err != nil {
+			if wait, ok := c.rateLimitWait(err); ok {
+				LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+					"channel", conv, "wait", wait.String())
+				err = sleep(ctx, wait)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+		pinned := make(map[string]bool, len(items))
+		for _, it := range items {
+			if it.Message != nil {
+				pinned[it.Message.Timestamp] = true
+			}
+		}
+		return pinned, nil
+	}
+}
+
+// deleteReplies deletes the replies in the thread started by the message at
+// parent in conv, leaving the parent itself to the caller. The replies go
+// through the same filters as top level messages.
+func (c *Cleaner) deleteReplies(ctx context.Context, conv string, parent string, stats *ConvStats) error {
+	params := slack.GetConversationRepliesParameters{
+		ChannelID: conv,
+		Timestamp: parent,
+	}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		callCtx, cancel := callContext(ctx)
+		msgs, hasMore, cursor, err := c.api.GetConversationRepliesContext(callCtx, &params)
+		cancel()
+		if err != nil {
+			if wait, ok := c.rateLimitWait(err); ok {
+				stats.RateLimits++
+				LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+					"channel", conv, "timestamp", parent, "wait", wait.String())
+				err = sleep(ctx, wait)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		for _, m := range msgs {
+			// The parent is always returned as the first message.
+			if m.Timestamp == parent {
+				continue
+			}
+			stats.replies++
+			ok, err := c.shouldDelete(m, stats)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			err = c.removeMessage(ctx, conv, m, stats)
+			if err != nil {
+				return err
+			}
+		}
+		if !hasMore || cursor == "" {
+			return nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// assistantThread is the subtype of the message an AI assistant app starts
+// each of its threads in the DM with a user with. The exchange itself lives
+// in the replies, so the thread is always looked into.
+const assistantThread = "assistant_app_thread"
+
+// isThreadParent reports whether m started a thread that has replies.
+func isThreadParent(m slack.Message) bool {
+	return m.ReplyCount > 0 || (m.ThreadTimestamp != "" && m.ThreadTimestamp == m.Timestamp) ||
+		m.SubType == assistantThread
+}
+
+// removeMessage deletes the message m in conv along with its uploaded files,
+// unless opts.KeepFiles is set, after removing the bot's reactions to it when
+// opts.ClearReactions is set. When opts.DryRun is set it is only logged, in
+// full with its author and text in the json log format. With opts.Redact it
+// is edited instead of deleted, unless an earlier run already did, which
+// counts as skipped, and its files and reactions are left as they are.
+// Either way it is counted in stats, and once opts.MaxMessages have been
+// counted errMaxMessages is returned instead. Messages the token is not
+// allowed to delete are logged and counted as denied, and those that are
+// already gone, such as after the history shifted under the cursor, are
+// counted as already deleted.
+func (c *Cleaner) removeMessage(ctx context.Context, conv string, m slack.Message, stats *ConvStats) error {
+	if c.opts.MaxMessages > 0 && stats.Deleted >= c.opts.MaxMessages {
+		return errMaxMessages
+	}
+	ts := m.Timestamp
+	// A redacted message stays, and with it its files and reactions.
+	if c.opts.ClearReactions && c.opts.Redact == "" {
+		err := c.clearReactions(ctx, conv, m, stats)
+		if err != nil {
+			return err
+		}
+	}
+	if !c.opts.KeepFiles && c.opts.Redact == "" {
+		for _, f := range m.Files {
+			err := c.removeFile(ctx, conv, ts, f.ID, stats)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if c.opts.DryRun {
+		switch {
+		case logJSON && c.opts.Redact != "":
+			LogEvent(LevelInfo, "would_redact",
+				fmt.Sprintf("Dry run: would redact message in channel %s with timestamp %s", conv, ts),
+				"channel", conv, "timestamp", ts, "user", m.User, "text", m.Text)
+		case logJSON:
+			// Logged in full at info so the plan of a dry run can be
+			// picked out of the json log, as with jq.
+			LogEvent(LevelInfo, "would_delete",
+				fmt.Sprintf("Dry run: would delete message in channel %s with timestamp %s", conv, ts),
+				"channel", conv, "timestamp", ts, "user", m.User, "text", m.Text)
+		case c.verbose() && c.opts.Redact != "":
+			LogEvent(LevelDebug, "would_redact",
+				fmt.Sprintf("Dry run: would redact message in channel %s with timestamp %s", conv, ts),
+				"channel", conv, "timestamp", ts)
+		case c.verbose():
+			LogEvent(LevelDebug, "would_delete",
+				fmt.Sprintf("Dry run: would delete message in channel %s with timestamp %s", conv, ts),
+				"channel", conv, "timestamp", ts)
+		}
+		stats.Deleted++
+		c.progress(Progress{Conv: conv, Deleted: stats.Deleted, Total: stats.total})
+		if c.opts.Redact != "" {
+			return c.report.record(conv, m, "would_redact")
+		}
+		return c.report.record(conv, m, "would_delete")
+	}
+	if c.opts.Redact != "" && m.Text == c.opts.Redact && len(m.Attachments) == 0 && len(m.Blocks.BlockSet) == 0 {
+		// Redacted by an earlier run.
+		stats.Skipped++
+		return nil
+	}
+	status := "deleted"
+	if c.opts.Redact != "" {
+		status = "redacted"
+	}
+	switch {
+	case c.opts.Redact != "" && !c.opts.Quiet:
+		LogEvent(LevelInfo, "redact",
+			fmt.Sprintf("Redacting message in channel %s with timestamp %s", conv, ts),
+			"channel", conv, "timestamp", ts)
+	case c.verbose():
+		LogEvent(LevelDebug, "delete",
+			fmt.Sprintf("Deleting message in channel %s with timestamp %s", conv, ts),
+			"channel", conv, "timestamp", ts)
+	}
+	err := c.deleteMessage(ctx, conv, ts, stats)
+	if isGone(err) {
+		stats.AlreadyDeleted++
+		if c.verbose() {
+			LogEvent(LevelDebug, "already_deleted",
+				fmt.Sprintf("Message in channel %s with timestamp %s was already deleted", conv, ts),
+				"channel", conv, "timestamp", ts)
+		}
+		return c.report.record(conv, m, "already_deleted")
+	}
+	if isUndeletable(err) {
+		stats.Denied++
+		if stats.denied == nil {
+			stats.denied = make(map[string]bool)
+		}
+		stats.denied[ts] = true
+		LogEvent(LevelWarn, "delete_denied",
+			fmt.Sprintf("Skipping message in channel %s with timestamp %s: %s", conv, ts, err),
+			"channel", conv, "timestamp", ts, "error", err.Error())
+		return c.report.record(conv, m, "denied")
+	}
+	if err != nil {
+		if rerr := c.report.record(conv, m, "failed"); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	stats.Deleted++
+	c.progress(Progress{Conv: conv, Deleted: stats.Deleted, Total: stats.total})
+	err = c.report.record(conv, m, status)
+	if err != nil {
+		return err
+	}
+	if c.opts.ProgressEvery > 0 && stats.Deleted%c.opts.ProgressEvery == 0 {
+		LogEvent(LevelInfo, "progress", stats.progress(conv),
+			"channel", conv, "count", stats.Deleted, "total", stats.total)
+	}
+	return nil
+}
+
+// removeFile deletes the uploaded file id attached to the message at ts in
+// conv, or only logs it when opts.DryRun is set. Files that are already gone,
+// or that the token can not delete, are logged and skipped since they should
+// not stop the messages from being cleaned. Like messages, file deletes are
+// throttled across all workers.
+func (c *Cleaner) removeFile(ctx context.Context, conv string, ts string, id string, stats *ConvStats) error {
+	if c.opts.DryRun {
+		if c.verbose() {
+			LogEvent(LevelDebug, "would_delete_file",
+				fmt.Sprintf("Dry run: would delete file %s of message %s in channel %s", id, ts, conv),
+				"channel", conv, "timestamp", ts, "file", id)
+		}
+		stats.Files++
+		return nil
+	}
+	for {
+		err := c.throttle(ctx)
+		if err != nil {
+			return err
+		}
+		callCtx, cancel := callContext(ctx)
+		err = c.api.DeleteFileContext(callCtx, id)
+		cancel()
+		if err == nil {
+			stats.limited = 0
+			stats.Files++
+			if c.verbose() {
+				LogEvent(LevelDebug, "delete_file",
+					fmt.Sprintf("Deleted file %s of message %s in channel %s", id, ts, conv),
+					"channel", conv, "timestamp", ts, "file", id)
+			}
+			return nil
+		}
+		if wait, ok := c.rateLimitWait(err); ok {
+			stats.RateLimits++
+			wait = stats.backoff(wait)
+			LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, pausing deletes for %s", wait),
+				"channel", conv, "timestamp", ts, "wait", wait.String())
+			c.pause.extend(wait)
+			continue
+		}
+		var slackErr slack.SlackErrorResponse
+		if errors.As(err, &slackErr) {
+			LogEvent(LevelWarn, "file_skipped",
+				fmt.Sprintf("Skipping file %s of message %s in channel %s: %s", id, ts, conv, err),
+				"channel", conv, "timestamp", ts, "file", id, "error", err.Error())
+			return nil
+		}
+		return err
+	}
+}
+
+// deleteMessage deletes the message at ts in conv, or redacts it with
+// opts.Redact. Rate limits are slept through without counting as an attempt,
+// while other transient errors are retried with exponential backoff from
+// opts.RetryWait until opts.MaxAttempts have been made.
+// Errors returned by the slack api itself are not retried. The waits and
+// failed attempts are counted in stats. Every call is first throttled, so a
+// rate limit hit by one worker pauses the deletes of all of them.
+//
+// A transient error does not mean the delete did not happen, only that its
+// response was lost. So once an attempt has failed that way, a retry that no
+// longer finds the message takes it as the earlier attempt having deleted it.
+func (c *Cleaner) deleteMessage(ctx context.Context, conv string, ts string, stats *ConvStats) error {
+	backoff := c.opts.RetryWait
+	if backoff == 0 {
+		backoff = DefaultRetryWait
+	}
+	inFlight := false
+	for attempt := 1; ; {
+		err := c.throttle(ctx)
+		if err != nil {
+			return err
+		}
+		callCtx, cancel := callContext(ctx)
+		if c.opts.Redact != "" {
+			_, _, _, err = c.api.UpdateMessageContext(callCtx, conv, ts,
+				slack.MsgOptionText(c.opts.Redact, false),
+				slack.MsgOptionAttachments([]slack.Attachment{}...),
+				slack.MsgOptionBlocks([]slack.Block{}...))
+		} else {
+			_, _, err = c.api.DeleteMessageContext(callCtx, conv, ts)
+		}
+		cancel()
+		if err == nil {
+			stats.limited = 0
+			return nil
+		}
+		if inFlight && isGone(err) {
+			LogEvent(LevelInfo, "retry_deleted",
+				fmt.Sprintf("Message in channel %s with timestamp %s was deleted by the failed attempt", conv, ts),
+				"channel", conv, "timestamp", ts)
+			return nil
+		}
+		if wait, ok := c.rateLimitWait(err); ok {
+			stats.RateLimits++
+			wait = stats.backoff(wait)
+			LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, pausing deletes for %s", wait),
+				"channel", conv, "timestamp", ts, "wait", wait.String())
+			c.pause.extend(wait)
+			continue
+		}
+		var slackErr slack.SlackErrorResponse
+		if errors.As(err, &slackErr) || attempt >= c.opts.MaxAttempts {
+			return err
+		}
+		inFlight = true
+		stats.Errors++
+		LogEvent(LevelWarn, "retry",
+			fmt.Sprintf("Deleting message in channel %s with timestamp %s failed, retrying in %s: %s", conv, ts, backoff, err),
+			"channel", conv, "timestamp", ts, "wait", backoff.String(), "error", err.Error())
+		err = sleep(ctx, backoff)
+		if err != nil {
+			return err
+		}
+		backoff *= 2
+		attempt++
+	}
+}
+
+// isUnavailable returns the slack api error when err means the bot can not
+// read conv at all, because it does not exist, the bot is not a member or
+// its kind of conversation has no history to read.
+func isUnavailable(err error) (string, bool) {
+	var slackErr slack.SlackErrorResponse
+	if !errors.As(err, &slackErr) {
+		return "", false
+	}
+	switch slackErr.Err {
+	case "channel_not_found", "not_in_channel", "method_not_supported_for_channel_type":
+		return slackErr.Err, true
+	}
+	return "", false
+}
+
+// isGone reports whether err is slack not finding a message to delete, which
+// means it was deleted already.
+func isGone(err error) bool {
+	var slackErr slack.SlackErrorResponse
+	return errors.As(err, &slackErr) && slackErr.Err == "message_not_found"
+}
+
+// isUndeletable reports whether err is slack refusing to delete a single
+// message, as opposed to a problem that should stop the run.
+func isUndeletable(err error) bool {
+	var slackErr slack.SlackErrorResponse
+	return errors.As(err, &slackErr) && undeletableErrors[slackErr.Err]
+}
@@ -0,0 +1,142 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestDeleteConversation(t *testing.T) {
+	transient := errors.New("connection reset by peer")
+	tests := []struct {
+		name        string
+		messages    int
+		pageSize    int
+		maxAttempts int
+		historyErrs []error
+		deleteErrs  []error
+
+		wantErr         bool
+		wantDeleted     int
+		wantCalls       int
+		wantRateLimits  int
+		wantCursors     []string
+		wantHistoryLeft int
+	}{
+		{
+			name:        "pages through the history with the cursor",
+			messages:    7,
+			pageSize:    3,
+			wantDeleted: 7,
+			wantCalls:   7,
+			// Each page starts just past the one before, whether or not
+			// its messages were deleted.
+			wantCursors: []string{"", fakeTimestamp(5), fakeTimestamp(2)},
+		},
+		{
+			name:           "waits out a rate limit on delete",
+			messages:       3,
+			deleteErrs:     []error{&slack.RateLimitedError{RetryAfter: time.Millisecond}},
+			wantDeleted:    3,
+			wantCalls:      4,
+			wantRateLimits: 1,
+			wantCursors:    []string{""},
+		},
+		{
+			name:           "waits out a rate limit on history",
+			messages:       2,
+			historyErrs:    []error{&slack.RateLimitedError{RetryAfter: time.Millisecond}},
+			wantDeleted:    2,
+			wantCalls:      2,
+			wantRateLimits: 1,
+			wantCursors:    []string{""},
+		},
+		{
+			name:        "retries a transient error",
+			messages:    2,
+			maxAttempts: 2,
+			deleteErrs:  []error{transient},
+			wantDeleted: 2,
+			wantCalls:   3,
+			wantCursors: []string{""},
+		},
+		{
+			name:            "gives up after MaxAttempts",
+			messages:        2,
+			maxAttempts:     2,
+			deleteErrs:      []error{transient, transient},
+			wantErr:         true,
+			wantCalls:       2,
+			wantCursors:     []string{""},
+			wantHistoryLeft: 2,
+		},
+		{
+			name:            "does not retry a slack error",
+			messages:        2,
+			maxAttempts:     3,
+			deleteErrs:      []error{slack.SlackErrorResponse{Err: "invalid_auth"}},
+			wantErr:         true,
+			wantCalls:       1,
+			wantCursors:     []string{""},
+			wantHistoryLeft: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(tt.messages, "C1")
+			api.pageSize = tt.pageSize
+			api.historyErrs = tt.historyErrs
+			api.deleteErrs = tt.deleteErrs
+			c := newTestCleaner(t, api, Options{MaxAttempts: tt.maxAttempts, RateLimitWait: time.Millisecond, RetryWait: time.Millisecond}, "C1")
+
+			stats, err := c.DeleteConversation(context.Background(), "C1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if stats.Deleted != tt.wantDeleted {
+				t.Errorf("got %d deleted, want %d", stats.Deleted, tt.wantDeleted)
+			}
+			if api.deleteCalls != tt.wantCalls {
+				t.Errorf("got %d delete calls, want %d", api.deleteCalls, tt.wantCalls)
+			}
+			if stats.RateLimits != tt.wantRateLimits {
+				t.Errorf("got %d rate limits, want %d", stats.RateLimits, tt.wantRateLimits)
+			}
+			if !reflect.DeepEqual(api.cursors["C1"], tt.wantCursors) {
+				t.Errorf("got cursors %q, want %q", api.cursors["C1"], tt.wantCursors)
+			}
+			if left := len(api.history["C1"]); left != tt.wantHistoryLeft {
+				t.Errorf("got %d messages left, want %d", left, tt.wantHistoryLeft)
+			}
+		})
+	}
+}
+
+func TestRedactKeepsFilesAndReactions(t *testing.T) {
+	api := newFakeAPI(0)
+	api.history["C1"] = []slack.Message{{Msg: slack.Msg{
+		Timestamp: fakeTimestamp(1),
+		Text:      "secret",
+		Files:     []slack.File{{ID: "F1"}},
+		Reactions: []slack.ItemReaction{{Name: "eyes", Count: 1, Users: []string{"UBOT"}}},
+	}}}
+	c := newTestCleaner(t, api, Options{Redact: "[redacted]", ClearReactions: true}, "C1")
+
+	stats, err := c.DeleteConversation(context.Background(), "C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Deleted != 1 {
+		t.Errorf("got %d redacted, want 1", stats.Deleted)
+	}
+	if len(api.fileDeletes) != 0 {
+		t.Errorf("got files deleted %q, want none", api.fileDeletes)
+	}
+	if len(api.reactionRemovals) != 0 {
+		t.Errorf("got reactions removed %q, want none", api.reactionRemovals)
+	}
+}
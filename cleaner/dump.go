@@ -0,0 +1,122 @@
+package cleaner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+)
+
+// dumpedMethods are the api methods whose every response is dumped, rather
+// than only the failed ones.
+var dumpedMethods = map[string]bool{
+	"conversations.history": true,
+}
+
+// DumpResponses returns a copy of client that writes the raw slack responses
+// to numbered files in dir, for debugging paging or rate limit problems: every
+// conversations.history response, and the response of any call that failed,
+// whether with an http error such as a 429, an ok: false body or no response
+// at all. Working responses are written as just their json body, and failed
+// ones with their status and headers, after the request that got them. The
+// token and other secrets of the request are redacted, so the dumps can be
+// shared. dir is created when missing.
+func DumpResponses(client *http.Client, dir string) (*http.Client, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating dump dir: %w", err)
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c := *client
+	c.Transport = &dumpTransport{next: next, dir: dir}
+	return &c, nil
+}
+
+// dumpTransport is the http.RoundTripper of DumpResponses.
+type dumpTransport struct {
+	next http.RoundTripper
+	dir  string
+	n    atomic.Int64
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.write(method, "error.txt", append(dumpRequest(req), redact(err.Error())+"\n"...))
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		t.write(method, "error.txt", append(dumpRequest(req), redact(err.Error())+"\n"...))
+		return resp, nil
+	}
+	var ok struct {
+		OK bool `json:"ok"`
+	}
+	failed := resp.StatusCode != http.StatusOK || json.Unmarshal(body, &ok) != nil || !ok.OK
+	switch {
+	case failed:
+		text, derr := httputil.DumpResponse(resp, false)
+		if derr == nil {
+			t.write(method, "error.txt", append(append(dumpRequest(req), text...), body...))
+		}
+	case dumpedMethods[method]:
+		t.write(method, "json", body)
+	}
+	return resp, nil
+}
+
+// secretValue matches the token, refresh token and client secret values of a
+// query string or form body, such as in the url of an error.
+var secretValue = regexp.MustCompile(`\b((?:\w+_)?token|client_secret)=[^&\s"]*`)
+
+// redact replaces the secret values in s.
+func redact(s string) string {
+	return secretValue.ReplaceAllString(s, "$1=[redacted]")
+}
+
+// dumpRequest returns the method, url, headers and form body of req as text,
+// with the Authorization header and the secret values redacted. The body is
+// only read when it can be again, as the body of a form post can.
+func dumpRequest(req *http.Request) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s\n", req.Method, redact(req.URL.String()))
+	h := req.Header.Clone()
+	if h.Get("Authorization") != "" {
+		h.Set("Authorization", "[redacted]")
+	}
+	h.Write(&b)
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			form, _ := io.ReadAll(body)
+			body.Close()
+			fmt.Fprintf(&b, "\n%s\n", redact(string(form)))
+		}
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// write writes b to the next numbered file of method, with the extension ext.
+// A dump that fails to be written is logged rather than failing the call.
+func (t *dumpTransport) write(method, ext string, b []byte) {
+	p := filepath.Join(t.dir, fmt.Sprintf("%05d-%s.%s", t.n.Add(1), method, ext))
+	err := os.WriteFile(p, b, 0o644)
+	if err != nil {
+		LogEvent(LevelWarn, "dump_failed", fmt.Sprintf("Writing the response dump %s: %s", p, err),
+			"path", p, "error", err.Error())
+	}
+}
@@ -0,0 +1,36 @@
+package cleaner
+
+import "errors"
+
+// The errors a run can fail with, for callers to tell apart with errors.Is.
+var (
+	// ErrInvalidToken is a config without an api token.
+	ErrInvalidToken = errors.New("invalid api token")
+	// ErrNoTargets is a config without a user, mpim or conversation to clean.
+	ErrNoTargets = errors.New("Need either one user, mpim or conversation")
+	// ErrInvalidEntry is a list entry in the config that is repeated or
+	// malformed.
+	ErrInvalidEntry = errors.New("invalid entry")
+	// ErrAuthFailed is returned by Run when slack rejects the api token.
+	ErrAuthFailed = errors.New("token rejected by Slack")
+	// ErrMissingScopes is returned by Run when the api token lacks scopes
+	// the run needs.
+	ErrMissingScopes = errors.New("token is missing scopes")
+	// ErrTooManyChannels is returned by Run when the config resolves to more
+	// conversations than Options.MaxChannels, without Options.Force.
+	ErrTooManyChannels = errors.New("too many conversations")
+)
+
+// ConfigError is returned by ValidateYmlFile with every problem found in a
+// config, which can be checked for the errors above with errors.Is.
+type ConfigError struct {
+	Errs []error
+}
+
+func (e *ConfigError) Error() string {
+	return errors.Join(e.Errs...).Error()
+}
+
+func (e *ConfigError) Unwrap() []error {
+	return e.Errs
+}
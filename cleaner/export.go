@@ -0,0 +1,133 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// exporter writes the messages of a conversation to a JSON array file. The
+// file is kept a valid array after every write, so an interrupted run still
+// leaves a readable export behind.
+type exporter struct {
+	f *os.File
+	n int
+}
+
+// checkExportDir makes sure dir exists and can be written to, so a run fails
+// before anything is deleted rather than part way through.
+func checkExportDir(dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("export dir: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".slack-bot-cleaner-")
+	if err != nil {
+		return fmt.Errorf("export dir not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// emptyExport is the content of an export file without any messages.
+const emptyExport = "[\n]\n"
+
+// newExporter creates the export file for the conversation conv in dir. When
+// resume is set, for a run picking up from a checkpoint, an existing file is
+// appended to instead, since it holds the pages deleted before the run was
+// cut short.
+func newExporter(dir string, conv string, resume bool) (*exporter, error) {
+	p := filepath.Join(dir, conv+".json")
+	if resume {
+		e, err := openExporter(p)
+		if !errors.Is(err, os.ErrNotExist) {
+			return e, err
+		}
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.WriteString(emptyExport)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &exporter{f: f}, nil
+}
+
+// openExporter opens the export file at p to append to it. It has to end the
+// way write leaves it, or it is refused rather than made invalid.
+func openExporter(p string) (*exporter, error) {
+	f, err := os.OpenFile(p, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size := fi.Size()
+	tail := make([]byte, min(size, int64(len(emptyExport))))
+	_, err = f.ReadAt(tail, size-int64(len(tail)))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	switch {
+	case string(tail) == emptyExport:
+		return &exporter{f: f}, nil
+	case strings.HasSuffix(string(tail), "\n]\n") && size > int64(len(emptyExport)):
+		// Only whether any messages were written matters to write.
+		return &exporter{f: f, n: 1}, nil
+	}
+	f.Close()
+	return nil, fmt.Errorf("export file %s is not a complete JSON array, move it away to resume", p)
+}
+
+// write appends msgs to the export file, just before its closing bracket.
+func (e *exporter) write(msgs []slack.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	// Step back over the closing "\n]\n", or just "]\n" when the array is
+	// still empty.
+	back := int64(3)
+	if e.n == 0 {
+		back = 2
+	}
+	_, err := e.f.Seek(-back, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if e.n > 0 {
+			_, err = e.f.WriteString(",\n")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = e.f.Write(b)
+		if err != nil {
+			return err
+		}
+		e.n++
+	}
+	_, err = e.f.WriteString("\n]\n")
+	return err
+}
+
+func (e *exporter) close() error {
+	return e.f.Close()
+}
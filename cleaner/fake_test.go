@@ -0,0 +1,284 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeAPI is an API that holds the history of its conversations in memory and
+// pages through it the way slack does: newest first, with a cursor pointing
+// just past the last message returned, so deleting messages does not move
+// the pages after it.
+type fakeAPI struct {
+	mu sync.Mutex
+	// history is the messages of each conversation, newest first, and
+	// replies the replies of each thread by conv/ts, its parent first.
+	history map[string][]slack.Message
+	replies map[string][]slack.Message
+	// pageSize is how many messages a history page holds when the call does
+	// not ask for fewer, 100 when 0.
+	pageSize int
+	// dms are the conversations opened with each comma separated user list.
+	dms map[string]string
+
+	// historyErrs and deleteErrs are returned by the next history and delete
+	// calls, one per call, before anything else is done.
+	historyErrs []error
+	deleteErrs  []error
+
+	// cursors are the cursors the history of each conversation was asked
+	// for, deletes the timestamps deleted in each, in order, and
+	// deleteCalls the number of delete calls made, failed ones included.
+	cursors     map[string][]string
+	deletes     map[string][]string
+	deleteCalls int
+	// replyReads are the threads whose replies were read, as conv/ts.
+	replyReads []string
+	// fileDeletes are the files deleted, and reactionRemovals the reactions
+	// removed, as name/ts.
+	fileDeletes      []string
+	reactionRemovals []string
+
+	// deleteDelay is how long each delete call takes. Meanwhile inFlight
+	// counts the delete calls made in each conversation, overlaps those
+	// made in a conversation that already had one in flight, and
+	// maxInFlight the most made at once across them all.
+	deleteDelay time.Duration
+	inFlight    map[string]int
+	overlaps    int
+	maxInFlight int
+}
+
+var _ API = (*fakeAPI)(nil)
+
+// newFakeAPI returns a fakeAPI with n messages in each of convs.
+func newFakeAPI(n int, convs ...string) *fakeAPI {
+	f := &fakeAPI{
+		history:  make(map[string][]slack.Message),
+		replies:  make(map[string][]slack.Message),
+		dms:      make(map[string]string),
+		cursors:  make(map[string][]string),
+		deletes:  make(map[string][]string),
+		inFlight: make(map[string]int),
+	}
+	for _, conv := range convs {
+		f.history[conv] = fakeMessages(n)
+	}
+	return f
+}
+
+// fakeMessages returns n messages, newest first.
+func fakeMessages(n int) []slack.Message {
+	msgs := make([]slack.Message, n)
+	for i := range msgs {
+		msgs[i] = slack.Message{Msg: slack.Msg{Timestamp: fakeTimestamp(n - i), Text: fmt.Sprintf("message %d", n-i)}}
+	}
+	return msgs
+}
+
+func fakeTimestamp(i int) string {
+	return fmt.Sprintf("1700000000.%06d", i)
+}
+
+// pop returns the first of errs and the rest of them.
+func pop(errs []error) (error, []error) {
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	return errs[0], errs[1:]
+}
+
+func (f *fakeAPI) AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error) {
+	return &slack.AuthTestResponse{User: "cleaner", UserID: "UBOT", Team: "team", TeamID: "T1", BotID: "B1"}, nil
+}
+
+func (f *fakeAPI) GetConversationsContext(ctx context.Context, params *slack.GetConversationsParameters) ([]slack.Channel, string, error) {
+	return nil, "", nil
+}
+
+func (f *fakeAPI) GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var err error
+	if err, f.historyErrs = pop(f.historyErrs); err != nil {
+		return nil, err
+	}
+	msgs, ok := f.history[params.ChannelID]
+	if !ok {
+		return nil, slack.SlackErrorResponse{Err: "channel_not_found"}
+	}
+	f.cursors[params.ChannelID] = append(f.cursors[params.ChannelID], params.Cursor)
+	size := f.pageSize
+	if size == 0 {
+		size = 100
+	}
+	if params.Limit > 0 && params.Limit < size {
+		size = params.Limit
+	}
+	resp := &slack.GetConversationHistoryResponse{}
+	resp.Ok = true
+	for _, m := range msgs {
+		if params.Cursor != "" && !newerTimestamp(params.Cursor, m.Timestamp) {
+			continue
+		}
+		if len(resp.Messages) == size {
+			resp.HasMore = true
+			resp.ResponseMetaData.NextCursor = resp.Messages[len(resp.Messages)-1].Timestamp
+			break
+		}
+		resp.Messages = append(resp.Messages, m)
+	}
+	return resp, nil
+}
+
+func (f *fakeAPI) GetConversationInfoContext(ctx context.Context, channelID string, includeLocale bool) (*slack.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.history[channelID]; !ok {
+		return nil, slack.SlackErrorResponse{Err: "channel_not_found"}
+	}
+	ch := &slack.Channel{}
+	ch.ID = channelID
+	return ch, nil
+}
+
+func (f *fakeAPI) UnArchiveConversationContext(ctx context.Context, channelID string) error {
+	return nil
+}
+
+func (f *fakeAPI) ArchiveConversationContext(ctx context.Context, channelID string) error {
+	return nil
+}
+
+func (f *fakeAPI) GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := params.ChannelID + "/" + params.Timestamp
+	f.replyReads = append(f.replyReads, key)
+	return f.replies[key], false, "", nil
+}
+
+func (f *fakeAPI) OpenConversationContext(ctx context.Context, params *slack.OpenConversationParameters) (*slack.Channel, bool, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id, ok := f.dms[strings.Join(params.Users, ",")]
+	if !ok {
+		return nil, false, false, slack.SlackErrorResponse{Err: "user_not_found"}
+	}
+	ch := &slack.Channel{}
+	ch.ID = id
+	return ch, false, false, nil
+}
+
+func (f *fakeAPI) GetUserByEmailContext(ctx context.Context, email string) (*slack.User, error) {
+	return nil, slack.SlackErrorResponse{Err: "users_not_found"}
+}
+
+func (f *fakeAPI) ListPinsContext(ctx context.Context, channel string) ([]slack.Item, *slack.Paging, error) {
+	return nil, nil, nil
+}
+
+func (f *fakeAPI) DeleteMessageContext(ctx context.Context, channel, messageTimestamp string) (string, string, error) {
+	if f.deleteDelay > 0 {
+		f.mu.Lock()
+		if f.inFlight[channel] > 0 {
+			f.overlaps++
+		}
+		f.inFlight[channel]++
+		total := 0
+		for _, n := range f.inFlight {
+			total += n
+		}
+		f.maxInFlight = max(f.maxInFlight, total)
+		f.mu.Unlock()
+		time.Sleep(f.deleteDelay)
+		defer func() {
+			f.mu.Lock()
+			f.inFlight[channel]--
+			f.mu.Unlock()
+		}()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleteCalls++
+	var err error
+	if err, f.deleteErrs = pop(f.deleteErrs); err != nil {
+		return "", "", err
+	}
+	if f.remove(channel, messageTimestamp) {
+		f.deletes[channel] = append(f.deletes[channel], messageTimestamp)
+		return channel, messageTimestamp, nil
+	}
+	return "", "", slack.SlackErrorResponse{Err: "message_not_found"}
+}
+
+// remove drops the message at ts from the history of conv, or from one of
+// its threads, reporting whether it was there.
+func (f *fakeAPI) remove(conv, ts string) bool {
+	for i, m := range f.history[conv] {
+		if m.Timestamp == ts {
+			f.history[conv] = append(f.history[conv][:i:i], f.history[conv][i+1:]...)
+			return true
+		}
+	}
+	for key, msgs := range f.replies {
+		for i, m := range msgs {
+			if key == conv+"/"+m.ThreadTimestamp && m.Timestamp == ts {
+				f.replies[key] = append(msgs[:i:i], msgs[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *fakeAPI) UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	return channelID, timestamp, "", nil
+}
+
+func (f *fakeAPI) DeleteFileContext(ctx context.Context, fileID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fileDeletes = append(f.fileDeletes, fileID)
+	return nil
+}
+
+func (f *fakeAPI) RemoveReactionContext(ctx context.Context, name string, item slack.ItemRef) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reactionRemovals = append(f.reactionRemovals, name+"/"+item.Timestamp)
+	return nil
+}
+
+func (f *fakeAPI) GetScheduledMessagesContext(ctx context.Context, params *slack.GetScheduledMessagesParameters) ([]slack.ScheduledMessage, string, error) {
+	return nil, "", nil
+}
+
+func (f *fakeAPI) DeleteScheduledMessageContext(ctx context.Context, params *slack.DeleteScheduledMessageParameters) (bool, error) {
+	return true, nil
+}
+
+// newTestCleaner returns a Cleaner of api for the conversations convs, with
+// opts.
+func newTestCleaner(t *testing.T, api API, opts Options, convs ...string) *Cleaner {
+	t.Helper()
+	c, err := New(api, &Config{Token: "xoxb-test", Convs: Convs(convs...)}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
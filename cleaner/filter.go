@@ -0,0 +1,160 @@
+package cleaner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// shouldDelete reports whether m passes the filters of the config, counting
+// it in stats when it is skipped.
+func (c *Cleaner) shouldDelete(m slack.Message, stats *ConvStats) (bool, error) {
+	ok, err := inWindow(m.Timestamp, c.windowOf(stats))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		stats.Skipped++
+		return false, nil
+	}
+	if stats.pinned[m.Timestamp] {
+		stats.Pinned++
+		stats.Skipped++
+		return false, nil
+	}
+	if reacted := len(m.Reactions) > 0; (c.opts.KeepReacted && reacted) || (c.opts.OnlyReacted && !reacted) {
+		stats.OtherReactions++
+		stats.Skipped++
+		return false, nil
+	}
+	if c.config.OnlyUser != "" && m.User != c.config.OnlyUser {
+		stats.OtherAuthor++
+		stats.Skipped++
+		return false, nil
+	}
+	if !subtypeAllowed(m.SubType, c.config.Subtypes) {
+		stats.OtherSubtype++
+		stats.Skipped++
+		return false, nil
+	}
+	if !contentAllowed(m, c.config) {
+		stats.OtherContent++
+		stats.Skipped++
+		return false, nil
+	}
+	if c.config.match != nil && !c.config.match.MatchString(m.Text) {
+		stats.NoMatch++
+		stats.Skipped++
+		return false, nil
+	}
+	return true, nil
+}
+
+// subtypeAllowed reports whether a message with subtype passes the subtypes
+// filter f.
+func subtypeAllowed(subtype string, f Subtypes) bool {
+	if contains(f.Exclude, subtype) {
+		return false
+	}
+	return len(f.Include) == 0 || contains(f.Include, subtype)
+}
+
+// contentAllowed reports whether m passes the has-attachments and has-blocks
+// filters of the config.
+func contentAllowed(m slack.Message, config *Config) bool {
+	if config.HasAttachments != nil && *config.HasAttachments != (len(m.Attachments) > 0) {
+		return false
+	}
+	if config.HasBlocks != nil && *config.HasBlocks != (len(m.Blocks.BlockSet) > 0) {
+		return false
+	}
+	return true
+}
+
+// window is the time messages have to be posted in to be deleted. Either
+// bound is zero when unset.
+type window struct {
+	before time.Time
+	after  time.Time
+}
+
+// windowOf returns the window of the conversation stats are for, which is
+// the config's unless its entry has one of its own.
+func (c *Cleaner) windowOf(stats *ConvStats) window {
+	if stats.window != nil {
+		return *stats.window
+	}
+	return window{before: c.config.before, after: c.config.after}
+}
+
+// inWindow reports whether the slack message timestamp ts falls strictly
+// inside w.
+func inWindow(ts string, w window) (bool, error) {
+	if w.before.IsZero() && w.after.IsZero() {
+		return true, nil
+	}
+	t, err := parseTimestamp(ts)
+	if err != nil {
+		return false, err
+	}
+	if !w.before.IsZero() && !t.Before(w.before) {
+		return false, nil
+	}
+	if !w.after.IsZero() && !t.After(w.after) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// parseTimestamp converts a slack message timestamp, which is unix epoch
+// seconds with microseconds after the dot, into a time.Time.
+func parseTimestamp(ts string) (time.Time, error) {
+	parts := strings.SplitN(ts, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid message timestamp %q", ts)
+	}
+	var usec int64
+	if len(parts) == 2 {
+		usec, err = strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid message timestamp %q", ts)
+		}
+	}
+	return time.Unix(sec, usec*int64(time.Microsecond)), nil
+}
+
+// parseTimeBound parses s as either an RFC3339 time, or an age relative to now
+// such as 30d, 2w or 12h.
+func parseTimeBound(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	age, err := ParseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, want RFC3339 or an age like 30d", s)
+	}
+	return now.Add(-age), nil
+}
+
+// ParseAge parses a duration that may also use the d (day) and w (week)
+// suffixes, on top of everything time.ParseDuration accepts.
+func ParseAge(s string) (time.Duration, error) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s, s[len(s)-1:]))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
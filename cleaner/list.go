@@ -0,0 +1,168 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/slack-go/slack"
+)
+
+// Inventory is a resolved conversation along with how many messages it holds.
+type Inventory struct {
+	Target
+	// Messages is the number of messages in the first page of history, up to
+	// MaxPageSize.
+	Messages int
+	// More is set when the conversation has more messages than were counted.
+	More bool
+	// Matching is set when Messages counts the messages of the whole
+	// history that pass the filters, as done by Count.
+	Matching bool
+}
+
+// List resolves the conversations in the config and counts their messages
+// with a single history call each, without deleting anything.
+func (c *Cleaner) List(ctx context.Context) ([]Inventory, error) {
+	targets, err := c.ResolveTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv := make([]Inventory, len(targets))
+	for i, t := range targets {
+		inv[i].Target = t
+		inv[i].Messages, inv[i].More, err = c.countMessages(ctx, t.Conv)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", t.Conv, err)
+		}
+	}
+	return inv, nil
+}
+
+// Count resolves the conversations in the config like List, but pages
+// through the whole history of each to count the top level messages that
+// pass the filters, without deleting anything. It takes a history call per
+// MaxPageSize messages, so it is slower than List but exact.
+func (c *Cleaner) Count(ctx context.Context) ([]Inventory, error) {
+	targets, err := c.ResolveTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inv := make([]Inventory, len(targets))
+	for i, t := range targets {
+		inv[i].Target = t
+		inv[i].Matching = true
+		inv[i].Messages, err = c.countMatching(ctx, t.Conv, nil)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", t.Conv, err)
+		}
+	}
+	return inv, nil
+}
+
+// countMessages returns the number of messages in the first MaxPageSize of
+// the history of conv, and whether there are more.
+func (c *Cleaner) countMessages(ctx context.Context, conv string) (int, bool, error) {
+	params := slack.GetConversationHistoryParameters{
+		ChannelID: conv,
+		Limit:     MaxPageSize,
+	}
+	for {
+		callCtx, cancel := callContext(ctx)
+		hist, err := c.api.GetConversationHistoryContext(callCtx, &params)
+		cancel()
+		if err != nil {
+			if wait, ok := c.rateLimitWait(err); ok {
+				LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+					"channel", conv, "wait", wait.String())
+				err = sleep(ctx, wait)
+				if err != nil {
+					return 0, false, err
+				}
+				continue
+			}
+			return 0, false, err
+		}
+		return len(hist.Messages), hist.HasMore, nil
+	}
+}
+
+// countMatching pages through the whole history of conv and returns how many
+// top level messages pass the filters, as a rough total for the progress
+// logs. Thread replies are not counted, and neither are the pinned messages.
+func (c *Cleaner) countMatching(ctx context.Context, conv string, pinned map[string]bool) (int, error) {
+	n := 0
+	err := c.eachMatching(ctx, conv, c.checkpoint.get(conv).Cursor, pinned, func(slack.Message) {
+		n++
+	})
+	return n, err
+}
+
+// eachMatching pages through the history of conv from cursor, calling fn with
+// every top level message that passes the filters and is not pinned.
+func (c *Cleaner) eachMatching(ctx context.Context, conv string, cursor string, pinned map[string]bool, fn func(slack.Message)) error {
+	params := slack.GetConversationHistoryParameters{
+		ChannelID: conv,
+		Cursor:    cursor,
+		Limit:     MaxPageSize,
+	}
+	scratch := ConvStats{pinned: pinned, window: c.windows[conv]}
+	for {
+		callCtx, cancel := callContext(ctx)
+		hist, err := c.api.GetConversationHistoryContext(callCtx, &params)
+		cancel()
+		if err != nil {
+			if wait, ok := c.rateLimitWait(err); ok {
+				LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+					"channel", conv, "wait", wait.String())
+				err = sleep(ctx, wait)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		for _, m := range hist.Messages {
+			ok, err := c.shouldDelete(m, &scratch)
+			if err != nil {
+				return err
+			}
+			if ok {
+				fn(m)
+			}
+		}
+		if !hist.HasMore || hist.ResponseMetaData.NextCursor == "" {
+			return nil
+		}
+		params.Cursor = hist.ResponseMetaData.NextCursor
+	}
+}
+
+// PrintInventory writes a table of each config entry in inv, the conversation
+// it resolved to and its message count to w, followed by the total of the
+// counts when they are from Count.
+func PrintInventory(w io.Writer, inv []Inventory) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "MESSAGES"
+	total := 0
+	for _, i := range inv {
+		if i.Matching {
+			header = "MATCHING"
+		}
+		total += i.Messages
+	}
+	fmt.Fprintf(tw, "ENTRY\tCHANNEL\t%s\n", header)
+	for _, i := range inv {
+		count := fmt.Sprint(i.Messages)
+		if i.More {
+			count += "+"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", i.Entry, i.Conv, count)
+	}
+	if header == "MATCHING" {
+		fmt.Fprintf(tw, "TOTAL\t\t%d\n", total)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,149 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Log levels used by LogEvent, from the most to the least verbose.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// levels ranks the log levels, so events below logLevel can be dropped.
+var levels = map[string]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+}
+
+// logJSON switches all log output to one json object per line.
+var logJSON bool
+
+// logLevel is the least severe level that is logged.
+var logLevel = LevelInfo
+
+// logColor colors the text format by what each event is about.
+var logColor bool
+
+// The ANSI colors of LogEvent.
+const (
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+	colorReset  = "\x1b[0m"
+)
+
+// deleteEvents are shown in green when colored.
+var deleteEvents = map[string]bool{
+	"delete":           true,
+	"redact":           true,
+	"delete_file":      true,
+	"delete_scheduled": true,
+	"remove_reaction":  true,
+	"retry_deleted":    true,
+	"page_done":        true,
+	"progress":         true,
+	"scheduled_done":   true,
+	"remove_bookmark":  true,
+	"bookmarks_done":   true,
+	"channel_done":     true,
+	"channel_cleared":  true,
+}
+
+// skipEvents are shown in yellow when colored, along with all warnings.
+var skipEvents = map[string]bool{
+	"author_skipped":    true,
+	"pinned_skipped":    true,
+	"subtype_skipped":   true,
+	"content_skipped":   true,
+	"reactions_skipped": true,
+	"protected_skip":    true,
+	"checkpoint_skip":   true,
+}
+
+// SetLogColor turns coloring the text format on or off. It is meant for a
+// terminal, and has no effect on the json format.
+func SetLogColor(on bool) {
+	logColor = on
+}
+
+// eventColor returns the color of an event at level, or "" for none.
+func eventColor(level, event string) string {
+	switch {
+	case level == LevelError:
+		return colorRed
+	case level == LevelWarn || skipEvents[event]:
+		return colorYellow
+	case deleteEvents[event]:
+		return colorGreen
+	}
+	return ""
+}
+
+// SetLogLevel sets the least severe level logged, one of debug, info, warn
+// or error. Anything less severe is dropped.
+func SetLogLevel(level string) error {
+	if _, ok := levels[level]; !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	logLevel = level
+	return nil
+}
+
+// LogLevelEnabled reports whether events at level are logged.
+func LogLevelEnabled(level string) bool {
+	return levels[level] >= levels[logLevel]
+}
+
+// SetLogFormat sets the format of all log output, either "text" or "json".
+func SetLogFormat(format string) error {
+	switch format {
+	case "text":
+		logJSON = false
+	case "json":
+		logJSON = true
+		log.SetFlags(0)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+// LogEvent logs msg, unless level is below the one set with SetLogLevel. In
+// the default text format only msg is printed, while in the json format the
+// level, event name and the key/value pairs in kv are written along with it
+// as a single json object.
+func LogEvent(level string, event string, msg string, kv ...interface{}) {
+	if !LogLevelEnabled(level) {
+		return
+	}
+	if !logJSON {
+		if color := eventColor(level, event); logColor && color != "" {
+			msg = color + msg + colorReset
+		}
+		log.Print(msg)
+		return
+	}
+	obj := map[string]interface{}{
+		"time":  time.Now().Format(time.RFC3339),
+		"level": level,
+		"event": event,
+		"msg":   msg,
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		obj[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		log.Printf("Encoding log event %s: %s", event, err)
+		return
+	}
+	fmt.Fprintln(log.Writer(), string(b))
+}
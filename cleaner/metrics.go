@@ -0,0 +1,40 @@
+package cleaner
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// WriteMetrics writes the stats of res to p in the Prometheus text format, for
+// node_exporter's textfile collector. The counts are labeled by channel. The
+// file is replaced in one rename, so the collector never reads half of it.
+func WriteMetrics(p string, res *Result) error {
+	var b bytes.Buffer
+	counters := []struct {
+		name, help string
+		value      func(ConvStats) int
+	}{
+		{"slack_cleaner_messages_deleted", "Messages deleted, or that would be in a dry run.", func(s ConvStats) int { return s.Deleted }},
+		{"slack_cleaner_scheduled_deleted", "Scheduled messages deleted, or that would be in a dry run.", func(s ConvStats) int { return s.Scheduled }},
+		{"slack_cleaner_files_deleted", "Files deleted along with their messages.", func(s ConvStats) int { return s.Files }},
+		{"slack_cleaner_messages_skipped", "Messages left alone by the filters.", func(s ConvStats) int { return s.Skipped }},
+		{"slack_cleaner_messages_denied", "Messages slack would not let the token delete.", func(s ConvStats) int { return s.Denied }},
+		{"slack_cleaner_messages_already_deleted", "Messages that were gone by the time they were deleted.", func(s ConvStats) int { return s.AlreadyDeleted }},
+		{"slack_cleaner_errors", "Errors, including retried ones.", func(s ConvStats) int { return s.Errors }},
+		{"slack_cleaner_rate_limits", "Times slack rate limited the run.", func(s ConvStats) int { return s.RateLimits }},
+	}
+	for _, m := range counters {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for i, conv := range res.Convs {
+			fmt.Fprintf(&b, "%s{channel=%q} %d\n", m.name, conv, m.value(res.Stats[i]))
+		}
+	}
+	fmt.Fprintf(&b, "# HELP slack_cleaner_run_duration_seconds How long the last run took.\n")
+	fmt.Fprintf(&b, "# TYPE slack_cleaner_run_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "slack_cleaner_run_duration_seconds %g\n", res.Elapsed.Seconds())
+	fmt.Fprintf(&b, "# HELP slack_cleaner_last_run_timestamp_seconds When the last run finished.\n")
+	fmt.Fprintf(&b, "# TYPE slack_cleaner_last_run_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "slack_cleaner_last_run_timestamp_seconds %d\n", time.Now().Unix())
+	return writeFileAtomic(p, b.Bytes(), 0o644)
+}
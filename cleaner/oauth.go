@@ -0,0 +1,105 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/slack-go/slack"
+	"gopkg.in/yaml.v2"
+)
+
+// refreshMargin is how long before TokenExpiry the token is already rotated,
+// so it does not run out part way through a run.
+const refreshMargin = time.Hour
+
+// Refresh rotates the api token with slack's oauth.v2.access endpoint
+// when the config has a refresh token and its access token is missing, has
+// no known expiry or expires within the hour. The new tokens and expiry are
+// set on the config, replacing a token given as a flag or env var, and written
+// back to the settings file the refresh token came from. The call is made
+// with client.
+func (c *Config) Refresh(ctx context.Context, client *http.Client) error {
+	if c.RefreshToken == "" {
+		return nil
+	}
+	if c.Token != "" && c.TokenExpiry != "" {
+		expiry, err := time.Parse(time.RFC3339, c.TokenExpiry)
+		if err == nil && time.Until(expiry) > refreshMargin {
+			return nil
+		}
+	}
+	resp, err := slack.RefreshOAuthV2TokenContext(ctx, client, c.ClientID, c.ClientSecret, c.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("refreshing token: %w", err)
+	}
+	c.Token = resp.AccessToken
+	c.RefreshToken = resp.RefreshToken
+	c.TokenExpiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second).UTC().Format(time.RFC3339)
+	LogEvent(LevelInfo, "token_refreshed", fmt.Sprintf("Refreshed api token, expires at %s", c.TokenExpiry),
+		"expiry", c.TokenExpiry)
+	if c.refreshPath == "" {
+		return nil
+	}
+	if !c.tokenInFile {
+		LogEvent(LevelWarn, "token_not_saved",
+			fmt.Sprintf("Not saving the refreshed token to %s, since its apitoken is not the token itself. Store the new token where it comes from, or the next run refreshes it again", c.refreshPath),
+			"path", c.refreshPath)
+		return nil
+	}
+	err = updateYmlFile(c.refreshPath, map[string]string{
+		"apitoken":     c.Token,
+		"refreshtoken": c.RefreshToken,
+		"tokenexpiry":  c.TokenExpiry,
+	})
+	if err != nil {
+		return fmt.Errorf("saving refreshed token to %s: %w", c.refreshPath, err)
+	}
+	return nil
+}
+
+// updateYmlFile sets the top level keys of the yaml file at p to the values
+// in set, keeping the order of the other keys and the mode of the file.
+// Comments are not kept. The file is replaced in one rename so it is never
+// left half written.
+func updateYmlFile(p string, set map[string]string) error {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	var doc yaml.MapSlice
+	err = yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(set))
+	for i, item := range doc {
+		key, _ := item.Key.(string)
+		if v, ok := set[key]; ok {
+			doc[i].Value = v
+			done[key] = true
+		}
+	}
+	var missing []string
+	for key := range set {
+		if !done[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		doc = append(doc, yaml.MapItem{Key: key, Value: set[key]})
+	}
+	b, err = yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, b, info.Mode().Perm())
+}
@@ -0,0 +1,72 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateYmlFileKeepsMode(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "settings.yml")
+	err := os.WriteFile(p, []byte("apitoken: xoxe.xoxb-old\nuserid: [U1]\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = updateYmlFile(p, map[string]string{"apitoken": "xoxe.xoxb-new", "tokenexpiry": "2030-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("got mode %o, want 600", mode)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "apitoken: xoxe.xoxb-new") || !strings.Contains(string(b), "userid:") {
+		t.Errorf("got file %q, want the new token and the users kept", b)
+	}
+}
+
+func TestTokenInFile(t *testing.T) {
+	t.Setenv(TokenEnv, "")
+	t.Setenv("TEST_SLACK_TOKEN", "xoxe.xoxb-env")
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token.txt")
+	if err := os.WriteFile(tokenFile, []byte("xoxe.xoxb-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		yml   string
+		token string
+		want  bool
+	}{
+		{"literal token", "apitoken: xoxe.xoxb-literal\n", "", true},
+		{"env var reference", "apitoken: ${TEST_SLACK_TOKEN}\n", "", false},
+		{"token file", "apitoken_file: " + tokenFile + "\n", "", false},
+		{"token flag", "apitoken: xoxe.xoxb-literal\n", "xoxe.xoxb-flag", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, "settings.yml")
+			yml := tt.yml + "refreshtoken: xoxe-1-refresh\nclientid: id\nclientsecret: secret\nuserid: [U1]\n"
+			if err := os.WriteFile(p, []byte(yml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c, err := ReadYmlFiles([]string{p}, tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.tokenInFile != tt.want {
+				t.Errorf("got tokenInFile %v, want %v", c.tokenInFile, tt.want)
+			}
+		})
+	}
+}
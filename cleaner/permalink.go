@@ -0,0 +1,39 @@
+package cleaner
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// parsePermalink returns the conversation and timestamp of the message that
+// the slack permalink s points to, such as
+// https://team.slack.com/archives/C0123ABCD/p1700000000000100. The
+// timestamp is the 16 digits after the p, with the dot put back in before the
+// last 6. The query of a link to a thread reply is ignored, since the path
+// already has the reply's own timestamp.
+func parsePermalink(s string) (conv string, ts string, err error) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", "", fmt.Errorf("not a slack permalink %q", s)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "archives" || !isSlackID(parts[1], "CGD") {
+		return "", "", fmt.Errorf("not a slack permalink %q", s)
+	}
+	digits := strings.TrimPrefix(parts[2], "p")
+	if len(digits) != 16 || digits == parts[2] {
+		return "", "", fmt.Errorf("no message timestamp in permalink %q", s)
+	}
+	ts = digits[:10] + "." + digits[10:]
+	if !validTimestamp(ts) {
+		return "", "", fmt.Errorf("no message timestamp in permalink %q", s)
+	}
+	return parts[1], ts, nil
+}
+
+// ReadPermalinks reads the slack message permalinks in the file at p, one per
+// line. Blank lines are skipped.
+func ReadPermalinks(p string) ([]string, error) {
+	return readLines(p)
+}
@@ -0,0 +1,28 @@
+package cleaner
+
+import "time"
+
+// Progress is an update on a run, sent on Options.Progress as it goes, such
+// as for a live display of it. An update about the run as a whole, rather
+// than one conversation, has no Conv.
+type Progress struct {
+	Conv string
+	// Deleted is how many messages were deleted in Conv so far, and Total
+	// the estimate of Options.Estimate, or 0 when unknown.
+	Deleted int
+	Total   int
+	// Done is set once Conv is cleaned, or failed to be.
+	Done bool
+	// Queued is set on the update sent as the run starts cleaning, to the
+	// number of conversations it is about to clean.
+	Queued int
+	// RateLimited is the wait slack asked for on a rate limit just hit.
+	RateLimited time.Duration
+}
+
+// progress sends p on opts.Progress, when set.
+func (c *Cleaner) progress(p Progress) {
+	if c.opts.Progress != nil {
+		c.opts.Progress <- p
+	}
+}
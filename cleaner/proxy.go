@@ -0,0 +1,57 @@
+package cleaner
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// NewHTTPClient returns the http client for the slack api, going through the
+// proxy at proxyURL when set, or else the one in the HTTPS_PROXY env var. Both
+// are checked up front so a bad proxy fails before any call is made.
+func NewHTTPClient(proxyURL string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != "" {
+		u, err := parseProxy(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	} else {
+		for _, env := range []string{"HTTPS_PROXY", "https_proxy"} {
+			if v := os.Getenv(env); v != "" {
+				_, err := parseProxy(v)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", env, err)
+				}
+				break
+			}
+		}
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// parseProxy parses s as the URL of an http, https or socks5 proxy. Like the
+// env var handling of net/http, a bare host:port is taken as an http proxy.
+func parseProxy(s string) (*url.URL, error) {
+	raw := s
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", s, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %q, want an http, https or socks5 url", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q, missing the host", s)
+	}
+	return u, nil
+}
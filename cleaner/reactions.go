@@ -0,0 +1,104 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// selfUser is the user ID of the bot, looked up once for ClearReactions.
+type selfUser struct {
+	mu sync.Mutex
+	id string
+}
+
+// selfID returns the user ID the token belongs to.
+func (c *Cleaner) selfID(ctx context.Context) (string, error) {
+	c.self.mu.Lock()
+	defer c.self.mu.Unlock()
+	if c.self.id != "" {
+		return c.self.id, nil
+	}
+	callCtx, cancel := callContext(ctx)
+	auth, err := c.api.AuthTestContext(callCtx)
+	cancel()
+	if err != nil {
+		return "", err
+	}
+	c.self.id = auth.UserID
+	return c.self.id, nil
+}
+
+// clearReactions removes the reactions the bot added to the message m in
+// conv. Slack only lets a token remove its own reactions, so the others are
+// left alone. The user list of a reaction can be cut short, in which case
+// the removal is tried anyway and a no_reaction answer ignored.
+func (c *Cleaner) clearReactions(ctx context.Context, conv string, m slack.Message, stats *ConvStats) error {
+	if len(m.Reactions) == 0 {
+		return nil
+	}
+	me, err := c.selfID(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range m.Reactions {
+		if !contains(r.Users, me) && len(r.Users) >= r.Count {
+			continue
+		}
+		if c.opts.DryRun {
+			if c.verbose() {
+				LogEvent(LevelDebug, "would_remove_reaction",
+					fmt.Sprintf("Dry run: would remove reaction %s from message %s in channel %s", r.Name, m.Timestamp, conv),
+					"channel", conv, "timestamp", m.Timestamp, "reaction", r.Name)
+			}
+			stats.Reactions++
+			continue
+		}
+		err = c.removeReaction(ctx, conv, m.Timestamp, r.Name, stats)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeReaction removes the bot's reaction name from the message at ts in
+// conv. Every call is throttled the same as the deletes, and a rate limit
+// pauses them all.
+func (c *Cleaner) removeReaction(ctx context.Context, conv string, ts string, name string, stats *ConvStats) error {
+	for {
+		err := c.throttle(ctx)
+		if err != nil {
+			return err
+		}
+		callCtx, cancel := callContext(ctx)
+		err = c.api.RemoveReactionContext(callCtx, name, slack.NewRefToMessage(conv, ts))
+		cancel()
+		if err == nil {
+			stats.limited = 0
+			stats.Reactions++
+			if c.verbose() {
+				LogEvent(LevelDebug, "remove_reaction",
+					fmt.Sprintf("Removed reaction %s from message %s in channel %s", name, ts, conv),
+					"channel", conv, "timestamp", ts, "reaction", name)
+			}
+			return nil
+		}
+		if wait, ok := c.rateLimitWait(err); ok {
+			stats.RateLimits++
+			wait = stats.backoff(wait)
+			LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, pausing deletes for %s", wait),
+				"channel", conv, "timestamp", ts, "wait", wait.String())
+			c.pause.extend(wait)
+			continue
+		}
+		var slackErr slack.SlackErrorResponse
+		if errors.As(err, &slackErr) && slackErr.Err == "no_reaction" {
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,80 @@
+package cleaner
+
+import (
+	"encoding/csv"
+	"os"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// reportFlushEvery is how many rows are buffered before the report is flushed
+// to disk, so an interrupted run loses at most this many.
+const reportFlushEvery = 20
+
+// reportTextLen is how many characters of a message's text go in the report.
+const reportTextLen = 80
+
+// reporter writes a CSV row for every message the workers remove.
+type reporter struct {
+	mu   sync.Mutex
+	f    *os.File
+	w    *csv.Writer
+	rows int
+}
+
+// newReporter creates the CSV report at p and writes its header row.
+func newReporter(p string) (*reporter, error) {
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	r := &reporter{f: f, w: csv.NewWriter(f)}
+	err = r.w.Write([]string{"channel", "timestamp", "user", "text", "status"})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.w.Flush()
+	return r, r.w.Error()
+}
+
+// record adds a row for the message m in conv with status, such as deleted or
+// denied. It does nothing on a nil reporter.
+func (r *reporter) record(conv string, m slack.Message, status string) error {
+	if r == nil {
+		return nil
+	}
+	text := []rune(m.Text)
+	if len(text) > reportTextLen {
+		text = append(text[:reportTextLen-1], '…')
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.w.Write([]string{conv, m.Timestamp, m.User, string(text), status})
+	if err != nil {
+		return err
+	}
+	r.rows++
+	if r.rows%reportFlushEvery == 0 {
+		r.w.Flush()
+		return r.w.Error()
+	}
+	return nil
+}
+
+// close flushes the rows left and closes the report.
+func (r *reporter) close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Flush()
+	err := r.w.Error()
+	cerr := r.f.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
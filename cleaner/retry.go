@@ -0,0 +1,151 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// callContext returns the context for a single slack api call. It keeps the
+// deadline of ctx but not its cancellation, so an interrupt lets the in-flight
+// call finish rather than abandoning it half way.
+func callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	c := context.WithoutCancel(ctx)
+	if d, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(c, d)
+	}
+	return context.WithCancel(c)
+}
+
+// sleep waits for d, returning early with the error of ctx if it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DefaultRateLimitWait is how long to sleep on a rate limit that does not say
+// when to retry, unless Options.RateLimitWait says otherwise.
+const DefaultRateLimitWait = 30 * time.Second
+
+// DefaultRetryWait is how long to wait before the first retry of a transient
+// error, unless Options.RetryWait says otherwise.
+const DefaultRetryWait = time.Second
+
+// rateLimitJitter is the fraction a rate limit sleep is randomly stretched or
+// shrunk by, so workers limited together do not all retry at the same moment.
+const rateLimitJitter = 0.2
+
+// httpStatusCoder is met by the error slack-go returns for an http status
+// other than 200, which is in an internal package.
+type httpStatusCoder interface {
+	HTTPStatusCode() int
+}
+
+// rateLimitWait reports whether err is a slack rate limit error, and how long
+// to sleep before trying again. Slack's Retry-After is used when present, only
+// ever stretched by the jitter since retrying sooner would be limited again.
+// Otherwise it falls back to base, or DefaultRateLimitWait when base is 0,
+// give or take the jitter.
+func rateLimitWait(err error, base time.Duration) (time.Duration, bool) {
+	var rlErr *slack.RateLimitedError
+	if errors.As(err, &rlErr) && rlErr.RetryAfter > 0 {
+		return rlErr.RetryAfter + time.Duration(rand.Float64()*rateLimitJitter*float64(rlErr.RetryAfter)), true
+	}
+	if !isRateLimit(err) {
+		return 0, false
+	}
+	if base <= 0 {
+		base = DefaultRateLimitWait
+	}
+	f := 1 + rateLimitJitter*(2*rand.Float64()-1)
+	return time.Duration(f * float64(base)), true
+}
+
+// isRateLimit reports whether err is slack limiting the rate of calls, in any
+// of the shapes slack-go returns that in: a RateLimitedError, an http 429
+// without a Retry-After, or a ratelimited api error. Matching the text of the
+// error is the last resort, for errors that lost their type on the way.
+func isRateLimit(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rlErr *slack.RateLimitedError
+	if errors.As(err, &rlErr) {
+		return true
+	}
+	var status httpStatusCoder
+	if errors.As(err, &status) && status.HTTPStatusCode() == http.StatusTooManyRequests {
+		return true
+	}
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) {
+		return slackErr.Err == "ratelimited" || slackErr.Err == "rate_limited"
+	}
+	return strings.Contains(err.Error(), "slack rate limit exceeded")
+}
+
+// rateLimitWait is rateLimitWait with the fallback of opts.RateLimitWait. A
+// rate limit is also sent to opts.Progress.
+func (c *Cleaner) rateLimitWait(err error) (time.Duration, bool) {
+	wait, ok := rateLimitWait(err, c.opts.RateLimitWait)
+	if ok {
+		c.progress(Progress{RateLimited: wait})
+	}
+	return wait, ok
+}
+
+// pause holds back the deletes of every worker once one of them has been rate
+// limited, since slack's limits are per workspace rather than per channel.
+type pause struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// extend makes the pause last at least d from now.
+func (p *pause) extend(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t := time.Now().Add(d); t.After(p.until) {
+		p.until = t
+	}
+}
+
+// wait sleeps until the pause is over, returning early with the error of ctx
+// if it is done first.
+func (p *pause) wait(ctx context.Context) error {
+	p.mu.Lock()
+	d := time.Until(p.until)
+	p.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	return sleep(ctx, d)
+}
+
+// throttle waits for any rate limit pause to be over, then opts.Delay, and
+// then for a turn on the limiter, before a delete call.
+func (c *Cleaner) throttle(ctx context.Context) error {
+	err := c.pause.wait(ctx)
+	if err != nil {
+		return err
+	}
+	if c.opts.Delay > 0 {
+		err = sleep(ctx, c.opts.Delay)
+		if err != nil {
+			return err
+		}
+	}
+	return c.limiter.Wait(ctx)
+}
@@ -0,0 +1,73 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// statusCodeError has the shape of the error slack-go returns for an http
+// status other than 200, which is in an internal package.
+type statusCodeError struct {
+	code int
+}
+
+func (e statusCodeError) Error() string {
+	return fmt.Sprintf("slack server error: %d", e.code)
+}
+
+func (e statusCodeError) HTTPStatusCode() int {
+	return e.code
+}
+
+func TestIsRateLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited error", &slack.RateLimitedError{RetryAfter: time.Second}, true},
+		{"wrapped rate limited error", fmt.Errorf("deleting: %w", &slack.RateLimitedError{}), true},
+		{"wrapped 429", fmt.Errorf("listing: %w", statusCodeError{http.StatusTooManyRequests}), true},
+		{"500", statusCodeError{http.StatusInternalServerError}, false},
+		{"ratelimited api error", slack.SlackErrorResponse{Err: "ratelimited"}, true},
+		{"rate_limited api error", slack.SlackErrorResponse{Err: "rate_limited"}, true},
+		{"other api error", slack.SlackErrorResponse{Err: "channel_not_found"}, false},
+		{"plain text", errors.New("slack rate limit exceeded, retry after 3s"), true},
+		{"other plain text", errors.New("connection reset by peer"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRateLimit(tt.err); got != tt.want {
+				t.Errorf("isRateLimit(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	base := 10 * time.Second
+	for _, tt := range []struct {
+		name     string
+		err      error
+		min, max time.Duration
+	}{
+		{"retry after", &slack.RateLimitedError{RetryAfter: 4 * time.Second}, 4 * time.Second, 4800 * time.Millisecond},
+		{"no retry after", slack.SlackErrorResponse{Err: "ratelimited"}, 8 * time.Second, 12 * time.Second},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, ok := rateLimitWait(tt.err, base)
+			if !ok || wait < tt.min || wait > tt.max {
+				t.Errorf("rateLimitWait(%v) = %s, %v, want between %s and %s", tt.err, wait, ok, tt.min, tt.max)
+			}
+		})
+	}
+	if _, ok := rateLimitWait(errors.New("connection reset by peer"), base); ok {
+		t.Error("rateLimitWait took a transient error for a rate limit")
+	}
+}
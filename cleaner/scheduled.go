@@ -0,0 +1,133 @@
+package cleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+// deleteScheduled deletes the messages queued up in conv with
+// chat.scheduleMessage, which never show up in its history. They are listed
+// in full before any is deleted, so deleting does not move the pages under
+// the cursor. Only the config's match pattern applies to them, since they
+// have no author or posted time of their own yet.
+func (c *Cleaner) deleteScheduled(ctx context.Context, conv string, stats *ConvStats) error {
+	msgs, err := c.scheduledMessages(ctx, conv, stats)
+	if err != nil {
+		return fmt.Errorf("listing scheduled messages: %w", err)
+	}
+	for _, m := range msgs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if c.config.match != nil && !c.config.match.MatchString(m.Text) {
+			stats.NoMatch++
+			stats.Skipped++
+			continue
+		}
+		err = c.removeScheduled(ctx, conv, m, stats)
+		if err != nil {
+			return err
+		}
+	}
+	if stats.Scheduled > 0 && !c.opts.Quiet {
+		msg := fmt.Sprintf("Deleted %d scheduled messages from %s", stats.Scheduled, conv)
+		if c.opts.DryRun {
+			msg = fmt.Sprintf("Dry run: would delete %d scheduled messages from %s", stats.Scheduled, conv)
+		}
+		LogEvent(LevelInfo, "scheduled_done", msg, "channel", conv, "count", stats.Scheduled)
+	}
+	return nil
+}
+
+// scheduledMessages pages through the messages scheduled in conv.
+func (c *Cleaner) scheduledMessages(ctx context.Context, conv string, stats *ConvStats) ([]slack.ScheduledMessage, error) {
+	params := slack.GetScheduledMessagesParameters{
+		Channel: conv,
+		Limit:   c.opts.PageSize,
+	}
+	var all []slack.ScheduledMessage
+	for {
+		callCtx, cancel := callContext(ctx)
+		msgs, cursor, err := c.api.GetScheduledMessagesContext(callCtx, &params)
+		cancel()
+		if err != nil {
+			if wait, ok := c.rateLimitWait(err); ok {
+				stats.RateLimits++
+				LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, sleeping for %s", wait),
+					"channel", conv, "wait", wait.String())
+				err = sleep(ctx, wait)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+		all = append(all, msgs...)
+		if cursor == "" {
+			return all, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// removeScheduled deletes the scheduled message m in conv, or only logs it
+// when opts.DryRun is set. Scheduled messages are deleted by their ID rather
+// than a timestamp, which is what goes in the timestamp column of the report.
+// A message that was posted or cancelled since it was listed is skipped.
+func (c *Cleaner) removeScheduled(ctx context.Context, conv string, m slack.ScheduledMessage, stats *ConvStats) error {
+	row := slack.Message{Msg: slack.Msg{Timestamp: m.ID, Text: m.Text}}
+	if c.opts.DryRun {
+		if c.verbose() {
+			LogEvent(LevelDebug, "would_delete_scheduled",
+				fmt.Sprintf("Dry run: would delete scheduled message %s in channel %s", m.ID, conv),
+				"channel", conv, "scheduled", m.ID)
+		}
+		stats.Scheduled++
+		return c.report.record(conv, row, "would_delete_scheduled")
+	}
+	for {
+		err := c.throttle(ctx)
+		if err != nil {
+			return err
+		}
+		callCtx, cancel := callContext(ctx)
+		_, err = c.api.DeleteScheduledMessageContext(callCtx, &slack.DeleteScheduledMessageParameters{
+			Channel:            conv,
+			ScheduledMessageID: m.ID,
+		})
+		cancel()
+		if err == nil {
+			stats.limited = 0
+			stats.Scheduled++
+			if c.verbose() {
+				LogEvent(LevelDebug, "delete_scheduled",
+					fmt.Sprintf("Deleted scheduled message %s in channel %s", m.ID, conv),
+					"channel", conv, "scheduled", m.ID)
+			}
+			return c.report.record(conv, row, "deleted_scheduled")
+		}
+		if wait, ok := c.rateLimitWait(err); ok {
+			stats.RateLimits++
+			wait = stats.backoff(wait)
+			LogEvent(LevelWarn, "rate_limited", fmt.Sprintf("Slack limit exceeded, pausing deletes for %s", wait),
+				"channel", conv, "scheduled", m.ID, "wait", wait.String())
+			c.pause.extend(wait)
+			continue
+		}
+		var slackErr slack.SlackErrorResponse
+		if errors.As(err, &slackErr) && slackErr.Err == "invalid_scheduled_message_id" {
+			LogEvent(LevelWarn, "scheduled_skipped",
+				fmt.Sprintf("Skipping scheduled message %s in channel %s: %s", m.ID, conv, err),
+				"channel", conv, "scheduled", m.ID, "error", err.Error())
+			return nil
+		}
+		if rerr := c.report.record(conv, row, "failed"); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+}
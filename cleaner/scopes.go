@@ -0,0 +1,167 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ScopesAPI returns the oauth scopes granted to the api token. Run only
+// checks them when the API passed to New also meets ScopesAPI, as a Client
+// does.
+type ScopesAPI interface {
+	TokenScopesContext(ctx context.Context) ([]string, error)
+}
+
+// TokenScopesContext returns the scopes of the token, read from the
+// X-OAuth-Scopes header of auth.test, or nil when slack does not say, as for
+// legacy tokens.
+func (w *webAPI) TokenScopesContext(ctx context.Context) ([]string, error) {
+	h, err := w.call(ctx, "auth.test", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var scopes []string
+	for _, s := range strings.Split(h.Get("X-OAuth-Scopes"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// scopeNeed is a scope a run needs, for which any of the scopes will do.
+type scopeNeed struct {
+	any []string
+	why string
+}
+
+// neededScopes returns the scopes a run of the config with opts needs. Those
+// for deleting are left out of a dry run, which only reads.
+func (c *Config) neededScopes(opts Options) []scopeNeed {
+	var needs []scopeNeed
+	need := func(why string, any ...string) {
+		needs = append(needs, scopeNeed{any: any, why: why})
+	}
+	names := false
+	for _, v := range c.Convs {
+		if strings.HasPrefix(v.Name, "#") || strings.Contains(v.Name, "*") {
+			names = true
+		}
+	}
+	emails := false
+	for _, u := range c.Users {
+		emails = emails || strings.Contains(u, "@")
+	}
+	for _, g := range c.MPIMs {
+		for _, u := range g {
+			emails = emails || strings.Contains(u, "@")
+		}
+	}
+	// Conversations given by ID only need the scopes of their kind, told by
+	// the prefix, so a DM listed as one does not need the channel scopes.
+	channels := false
+	for _, v := range c.Convs {
+		switch {
+		case isSlackID(v.Name, "D"):
+			need("reading DMs", "im:history")
+			need("looking up DMs", "im:read")
+		case isSlackID(v.Name, "G"):
+			need("reading private channels and group DMs", "groups:history", "mpim:history")
+			need("looking up private channels and group DMs", "groups:read", "mpim:read")
+			channels = true
+		default:
+			need("reading channels", "channels:history", "groups:history")
+			need("looking up channels", "channels:read", "groups:read")
+			channels = true
+		}
+	}
+	if names || len(c.Protected) > 0 {
+		need("listing channels by name", "channels:read", "groups:read")
+	}
+	if len(c.Users) > 0 {
+		need("reading DMs", "im:history")
+		need("looking up DMs", "im:read")
+		need("opening DMs", "im:write")
+	}
+	if len(c.MPIMs) > 0 {
+		need("reading group DMs", "mpim:history")
+		need("looking up group DMs", "mpim:read")
+		need("opening group DMs", "mpim:write")
+	}
+	if emails {
+		need("looking up users by email", "users:read.email")
+	}
+	if len(c.Permalinks) > 0 {
+		need("reading linked messages", "channels:history", "groups:history", "im:history", "mpim:history")
+	}
+	if opts.KeepPinned {
+		need("keeping pinned messages", "pins:read")
+	}
+	if opts.ClearBookmarks {
+		need("listing bookmarks", "bookmarks:read")
+	}
+	if opts.DryRun {
+		return needs
+	}
+	need("deleting messages", "chat:write")
+	if opts.ClearReactions {
+		need("removing reactions", "reactions:write")
+	}
+	if opts.ClearBookmarks {
+		need("removing bookmarks", "bookmarks:write")
+	}
+	if opts.Unarchive && channels {
+		need("unarchiving channels", "channels:write", "groups:write")
+	}
+	return needs
+}
+
+// MissingScopes returns the scopes a run of the config with opts needs that
+// are not among granted, each along with what it is needed for.
+func (c *Config) MissingScopes(granted []string, opts Options) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, n := range c.neededScopes(opts) {
+		ok := false
+		for _, s := range n.any {
+			ok = ok || contains(granted, s)
+		}
+		if ok {
+			continue
+		}
+		msg := fmt.Sprintf("%s (for %s)", strings.Join(n.any, " or "), n.why)
+		if !seen[msg] {
+			seen[msg] = true
+			missing = append(missing, msg)
+		}
+	}
+	return missing
+}
+
+// checkScopes fails with ErrMissingScopes when the token lacks any of the
+// scopes the run needs, so it stops before the first call that needs them.
+// When the scopes can not be told the run goes ahead.
+func (c *Cleaner) checkScopes(ctx context.Context) error {
+	if c.scopes == nil {
+		LogEvent(LevelDebug, "scopes_unknown", "The API does not list the scopes of the token, not checking them")
+		return nil
+	}
+	callCtx, cancel := callContext(ctx)
+	scopes, err := c.scopes.TokenScopesContext(callCtx)
+	cancel()
+	if err != nil {
+		LogEvent(LevelWarn, "scopes_unknown", fmt.Sprintf("Could not check the scopes of the token: %s", err),
+			"error", err.Error())
+		return nil
+	}
+	if scopes == nil {
+		LogEvent(LevelDebug, "scopes_unknown", "Slack did not list the scopes of the token, not checking them")
+		return nil
+	}
+	missing := c.config.MissingScopes(scopes, c.opts)
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingScopes, strings.Join(missing, ", "))
+	}
+	return nil
+}
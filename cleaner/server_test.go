@@ -0,0 +1,193 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// fakeServer serves the web api methods a run over DMs calls, backed by the
+// history of a fakeAPI, so a Client can be pointed at it and the http side
+// of the slack client is exercised too.
+type fakeServer struct {
+	*httptest.Server
+	api *fakeAPI
+	// scopes are sent back in the X-OAuth-Scopes header of auth.test.
+	scopes string
+
+	mu sync.Mutex
+	// limited is how many of the next calls of each method are answered
+	// with a 429, with a Retry-After of a second.
+	limited map[string]int
+	calls   []string
+}
+
+// newFakeServer starts a fakeServer over api, closed when t is done.
+func newFakeServer(t *testing.T, api *fakeAPI, scopes string) *fakeServer {
+	s := &fakeServer{api: api, scopes: scopes, limited: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// client returns a Client calling s with token. Calls to any other host
+// fail, so one that does not go through the api url is caught.
+func (s *fakeServer) client(token string) *Client {
+	hc := s.Server.Client()
+	hc.Transport = onlyHost{host: strings.TrimPrefix(s.URL, "http://"), next: hc.Transport}
+	return NewClient(token, s.URL+"/", hc)
+}
+
+// onlyHost is a transport refusing the requests to any host but host.
+type onlyHost struct {
+	host string
+	next http.RoundTripper
+}
+
+func (o onlyHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != o.host {
+		return nil, fmt.Errorf("request to %s, outside of the fake server", req.URL)
+	}
+	return o.next.RoundTrip(req)
+}
+
+func (s *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	s.mu.Lock()
+	s.calls = append(s.calls, method)
+	limited := s.limited[method] > 0
+	if limited {
+		s.limited[method]--
+	}
+	s.mu.Unlock()
+	if limited {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	var resp interface{}
+	var err error
+	switch method {
+	case "auth.test":
+		w.Header().Set("X-OAuth-Scopes", s.scopes)
+		resp, err = s.api.AuthTestContext(ctx)
+	case "conversations.open":
+		var ch *slack.Channel
+		ch, _, _, err = s.api.OpenConversationContext(ctx, &slack.OpenConversationParameters{
+			Users: strings.Split(r.Form.Get("users"), ","),
+		})
+		resp = map[string]interface{}{"channel": ch}
+	case "conversations.info":
+		var ch *slack.Channel
+		ch, err = s.api.GetConversationInfoContext(ctx, r.Form.Get("channel"), false)
+		resp = map[string]interface{}{"channel": ch}
+	case "conversations.history":
+		limit, _ := strconv.Atoi(r.Form.Get("limit"))
+		resp, err = s.api.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+			ChannelID: r.Form.Get("channel"),
+			Cursor:    r.Form.Get("cursor"),
+			Limit:     limit,
+		})
+	case "conversations.replies":
+		var msgs []slack.Message
+		msgs, _, _, err = s.api.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
+			ChannelID: r.Form.Get("channel"),
+			Timestamp: r.Form.Get("ts"),
+		})
+		resp = map[string]interface{}{"messages": msgs}
+	case "chat.delete":
+		var ch, ts string
+		ch, ts, err = s.api.DeleteMessageContext(ctx, r.Form.Get("channel"), r.Form.Get("ts"))
+		resp = map[string]interface{}{"channel": ch, "ts": ts}
+	default:
+		err = slack.SlackErrorResponse{Err: "unknown_method"}
+	}
+	var slackErr slack.SlackErrorResponse
+	switch {
+	case errors.As(err, &slackErr):
+		resp = map[string]interface{}{"ok": false, "error": slackErr.Err}
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if slackErr.Err == "" {
+		// Every response of these methods is an object, to which ok is
+		// added.
+		b = append([]byte(`{"ok":true,`), b[1:]...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// dmScopes are the scopes a run over DMs needs.
+const dmScopes = "im:history,im:read,im:write,chat:write"
+
+func TestRunAgainstServer(t *testing.T) {
+	api := newFakeAPI(5, "D1")
+	api.pageSize = 2
+	api.dms["U1"] = "D1"
+	srv := newFakeServer(t, api, dmScopes)
+	srv.limited["conversations.history"] = 1
+	srv.limited["chat.delete"] = 1
+	config := &Config{Token: "xoxb-test", Users: []string{"U1"}}
+	c, err := New(srv.client(config.Token), config, Options{MaxAttempts: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Convs) != 1 || res.Convs[0] != "D1" {
+		t.Fatalf("got conversations %q, want [D1]", res.Convs)
+	}
+	st := res.Stats[0]
+	if st.Deleted != 5 || st.RateLimits != 2 || st.Errors != 0 {
+		t.Errorf("got %d deleted, %d rate limits and %d errors, want 5, 2 and 0", st.Deleted, st.RateLimits, st.Errors)
+	}
+	if left := len(api.history["D1"]); left != 0 {
+		t.Errorf("got %d messages left, want none", left)
+	}
+}
+
+func TestRunAgainstServerMissingScopes(t *testing.T) {
+	api := newFakeAPI(1, "D1")
+	api.dms["U1"] = "D1"
+	srv := newFakeServer(t, api, "im:history,im:read,im:write")
+	config := &Config{Token: "xoxb-test", Users: []string{"U1"}}
+	c, err := New(srv.client(config.Token), config, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Run(context.Background())
+	if !errors.Is(err, ErrMissingScopes) {
+		t.Fatalf("got error %v, want ErrMissingScopes", err)
+	}
+	if !strings.Contains(err.Error(), "chat:write") {
+		t.Errorf("got error %v, want it to name chat:write", err)
+	}
+	if api.deleteCalls != 0 {
+		t.Errorf("got %d delete calls, want none", api.deleteCalls)
+	}
+}
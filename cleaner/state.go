@@ -0,0 +1,87 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// DefaultStatePath is where the latest message of each conversation is
+// recorded for Options.SinceLastRun, unless Options.StatePath says otherwise.
+const DefaultStatePath = ".slack-cleaner-state.json"
+
+// runState records the timestamp of the newest message seen inside the window
+// of each conversation by the last successful run, so the next one can start
+// from there. A nil runState records nothing.
+type runState struct {
+	path string
+
+	mu     sync.Mutex
+	Latest map[string]string `json:"latest"`
+}
+
+// loadState reads the state file at path, starting a new one if it does not
+// exist yet.
+func loadState(path string) (*runState, error) {
+	s := &runState{path: path, Latest: make(map[string]string)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, s)
+	if err != nil {
+		return nil, err
+	}
+	if s.Latest == nil {
+		s.Latest = make(map[string]string)
+	}
+	return s, nil
+}
+
+// latest returns the timestamp of the newest message of conv seen by the last
+// run, or "" if there was none.
+func (s *runState) latest(conv string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Latest[conv]
+}
+
+// save records ts as the newest message of conv and writes the state file. A
+// ts that is not newer than the one already recorded is ignored.
+func (s *runState) save(conv string, ts string) error {
+	if s == nil || ts == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.Latest[conv]; ok && !newerTimestamp(ts, old) {
+		return nil
+	}
+	s.Latest[conv] = ts
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b, 0o644)
+}
+
+// newerTimestamp reports whether the slack timestamp a is after b. Anything
+// that does not parse is taken as older.
+func newerTimestamp(a, b string) bool {
+	ta, err := parseTimestamp(a)
+	if err != nil {
+		return false
+	}
+	tb, err := parseTimestamp(b)
+	if err != nil {
+		return true
+	}
+	return ta.After(tb)
+}
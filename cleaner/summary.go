@@ -0,0 +1,269 @@
+package cleaner
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// ConvStats counts what happened while cleaning a single conversation.
+type ConvStats struct {
+	Deleted    int
+	Skipped    int
+	Errors     int
+	RateLimits int
+	Files      int
+
+	// OtherAuthor is the part of Skipped that was not posted by the
+	// config's onlyuser.
+	OtherAuthor int
+	// OtherSubtype is the part of Skipped left out by the config's subtypes
+	// filter.
+	OtherSubtype int
+	// OtherContent is the part of Skipped left out by the config's
+	// has-attachments and has-blocks filters.
+	OtherContent int
+	// Pinned is the part of Skipped left alone for being pinned.
+	Pinned int
+	// OtherReactions is the part of Skipped left out by KeepReacted or
+	// OnlyReacted.
+	OtherReactions int
+	// NoMatch is the part of Skipped whose text did not match the config's
+	// match pattern.
+	NoMatch int
+	// Reactions are the bot's reactions removed by ClearReactions.
+	Reactions int
+	// Denied are the messages slack would not let the token delete.
+	Denied int
+	// AlreadyDeleted are the messages that were gone by the time they were
+	// deleted, which are not part of Deleted.
+	AlreadyDeleted int
+	// Scheduled are the scheduled messages deleted by IncludeScheduled,
+	// which are not part of Deleted.
+	Scheduled int
+	// Bookmarks are the bookmarks removed by ClearBookmarks.
+	Bookmarks int
+	// Leftover are the messages Verify found still there after deleting.
+	Leftover int
+	// Unaccounted are the messages read from the history, thread replies
+	// included, that ended up in none of Deleted, Skipped, Denied and
+	// AlreadyDeleted once it was gone through, or minus those counted twice.
+	// Anything but 0 points at a paging bug or missed messages.
+	Unaccounted int
+	// ExtShared is set when the conversation is shared with other
+	// organizations, whose messages slack does not let be deleted.
+	ExtShared bool
+	// Unavailable is why the conversation could not be read at all, such as
+	// not_in_channel, or empty when it was.
+	Unavailable string
+
+	// began is when the cleaning started, and total the estimated number of
+	// messages to delete or 0 when unknown, for the progress logs.
+	began time.Time
+	total int
+	// pinned are the timestamps of the pinned messages kept by KeepPinned.
+	pinned map[string]bool
+	// latest is the timestamp of the newest message seen inside the window,
+	// for the state file of SinceLastRun.
+	latest string
+	// seen is how many messages of the history were read, to tell an empty
+	// conversation apart from one with nothing to delete.
+	seen int
+	// limited is how many deletes in a row were rate limited, see backoff.
+	limited int
+	// replies is how many thread replies were read, which seen leaves out.
+	replies int
+	// window, when set, is the window of the conversation's own config
+	// entry, which replaces the one of the config.
+	window *window
+	// reached is the timestamp of the message being handled, and cursor the
+	// one of the page after it, so an interrupted run can say where it
+	// stopped. done is set once the whole history was gone through.
+	reached string
+	cursor  string
+	done    bool
+	// denied are the timestamps of the Denied messages, which Verify
+	// expects to find left over.
+	denied map[string]bool
+}
+
+// add adds the counts of o to s.
+func (s *ConvStats) add(o ConvStats) {
+	s.Deleted += o.Deleted
+	s.Skipped += o.Skipped
+	s.Errors += o.Errors
+	s.RateLimits += o.RateLimits
+	s.Files += o.Files
+	s.OtherAuthor += o.OtherAuthor
+	s.OtherSubtype += o.OtherSubtype
+	s.OtherContent += o.OtherContent
+	s.NoMatch += o.NoMatch
+	s.Pinned += o.Pinned
+	s.OtherReactions += o.OtherReactions
+	s.Denied += o.Denied
+	s.AlreadyDeleted += o.AlreadyDeleted
+	s.Reactions += o.Reactions
+	s.Leftover += o.Leftover
+	s.Scheduled += o.Scheduled
+	s.Bookmarks += o.Bookmarks
+	s.Unaccounted += o.Unaccounted
+}
+
+// PrintSummary writes a table of the stats of each conversation in res to w,
+// followed by the grand totals, the conversations that had nothing to delete,
+// those that could not be read, those with messages left over after verifying,
+// those whose counts did not add up to the messages read and those shared with
+// other organizations.
+func PrintSummary(w io.Writer, res *Result, dryRun bool) {
+	deleted := "DELETED"
+	if dryRun {
+		deleted = "WOULD DELETE"
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "CHANNEL\t%s\tFILES\tSKIPPED\tDENIED\tALREADY DELETED\tERRORS\tRATE LIMITS\n", deleted)
+	var total ConvStats
+	for i, c := range res.Convs {
+		st := res.Stats[i]
+		total.add(st)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", c, st.Deleted, st.Files, st.Skipped, st.Denied, st.AlreadyDeleted, st.Errors, st.RateLimits)
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", total.Deleted, total.Files, total.Skipped, total.Denied, total.AlreadyDeleted, total.Errors, total.RateLimits)
+	tw.Flush()
+	header := false
+	for i, c := range res.Convs {
+		st := res.Stats[i]
+		if !st.nothingDeleted() {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "\nNothing to delete:")
+			header = true
+		}
+		if st.seen == 0 {
+			fmt.Fprintf(w, "  %s: empty\n", c)
+		} else {
+			fmt.Fprintf(w, "  %s: %d messages, none passed the filters\n", c, st.seen)
+		}
+	}
+	header = false
+	for i, c := range res.Convs {
+		reason := res.Stats[i].Unavailable
+		if reason == "" {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "\nSkipped channels, these need attention:")
+			header = true
+		}
+		fmt.Fprintf(w, "  %s: %s\n", c, reason)
+	}
+	header = false
+	for i, c := range res.Convs {
+		n := res.Stats[i].Leftover
+		if n == 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "\nFailed to delete, still there after verifying:")
+			header = true
+		}
+		fmt.Fprintf(w, "  %s: %d messages\n", c, n)
+	}
+	header = false
+	for i, c := range res.Convs {
+		n := res.Stats[i].Unaccounted
+		if n == 0 {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "\nCounts not adding up to the messages read, some may have been missed:")
+			header = true
+		}
+		fmt.Fprintf(w, "  %s: %d messages unaccounted for\n", c, n)
+	}
+	header = false
+	for i, c := range res.Convs {
+		if !res.Stats[i].ExtShared {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "\nShared with other organizations, only this one's messages can be deleted:")
+			header = true
+		}
+		fmt.Fprintf(w, "  %s: %d denied\n", c, res.Stats[i].Denied)
+	}
+}
+
+// PrintResume writes where the cleaning of each conversation in res stopped
+// to w, for a run that was interrupted, so it can be picked up from there by
+// hand. oldestFirst is whether the history was walked from the oldest
+// message, which decides whether before or after would resume it.
+func PrintResume(w io.Writer, res *Result, oldestFirst bool) {
+	fmt.Fprintln(w, "\nInterrupted, to pick up where each conversation stopped:")
+	for i, c := range res.Convs {
+		st := res.Stats[i]
+		switch {
+		case st.done || st.Unavailable != "":
+			continue
+		case st.reached == "":
+			fmt.Fprintf(w, "  %s: not started\n", c)
+			continue
+		}
+		msg := fmt.Sprintf("  %s: stopped at message %s", c, st.reached)
+		if t, err := parseTimestamp(st.reached); err == nil {
+			if oldestFirst {
+				msg += fmt.Sprintf(", resume with after: %s", t.Add(-time.Second).UTC().Format(time.RFC3339))
+			} else {
+				msg += fmt.Sprintf(", resume with before: %s", t.Add(time.Second).UTC().Format(time.RFC3339))
+			}
+		}
+		if st.cursor != "" {
+			msg += fmt.Sprintf(", next page cursor %s", st.cursor)
+		}
+		fmt.Fprintln(w, msg)
+	}
+}
+
+// maxBackoff caps the pause of backoff.
+const maxBackoff = 5 * time.Minute
+
+// backoff returns the pause for a delete that was rate limited with wait,
+// counting it in s. The wait is doubled for each delete before it that was
+// also rate limited in a row, up to maxBackoff, since a pause of just wait
+// keeps getting limited again when slack is throttling hard. A delete that
+// goes through resets it.
+func (s *ConvStats) backoff(wait time.Duration) time.Duration {
+	d := wait
+	for i := 0; i < s.limited && d < maxBackoff; i++ {
+		d *= 2
+	}
+	s.limited++
+	// The cap is only on the doubling, slack's own wait always holds.
+	return max(wait, min(d, maxBackoff))
+}
+
+// nothingDeleted reports whether the history of the conversation was read in
+// full without anything in it to delete.
+func (s *ConvStats) nothingDeleted() bool {
+	return !s.began.IsZero() && s.Unavailable == "" && s.Errors == 0 &&
+		s.Deleted == 0 && s.Denied == 0 && s.AlreadyDeleted == 0 && s.Scheduled == 0
+}
+
+// progress returns the running total of s as a log message, with the rate
+// messages are being deleted at and, when the total is known, a rough time
+// remaining.
+func (s *ConvStats) progress(conv string) string {
+	msg := fmt.Sprintf("Deleted %d messages so far in channel %s", s.Deleted, conv)
+	elapsed := time.Since(s.began)
+	if s.began.IsZero() || elapsed <= 0 {
+		return msg
+	}
+	rate := float64(s.Deleted) / elapsed.Seconds()
+	msg += fmt.Sprintf(" at %.1f/s", rate)
+	if s.total > s.Deleted && rate > 0 {
+		left := time.Duration(float64(s.total-s.Deleted) / rate * float64(time.Second))
+		msg += fmt.Sprintf(", ~%s remaining", left.Round(time.Minute))
+	}
+	return msg
+}
@@ -0,0 +1,83 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// The statuses of a run in the json summary.
+const (
+	StatusOK          = "ok"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// jsonSummary is the json summary of a run, see WriteSummaryJSON.
+type jsonSummary struct {
+	Status          string            `json:"status"`
+	Error           string            `json:"error,omitempty"`
+	DryRun          bool              `json:"dry_run"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	Identities      []Identity        `json:"identities"`
+	Channels        []jsonChannelStat `json:"channels"`
+}
+
+// jsonChannelStat is the counts of a conversation in the json summary.
+type jsonChannelStat struct {
+	Channel        string `json:"channel"`
+	Deleted        int    `json:"deleted"`
+	Skipped        int    `json:"skipped"`
+	Errors         int    `json:"errors"`
+	Files          int    `json:"files"`
+	Denied         int    `json:"denied"`
+	AlreadyDeleted int    `json:"already_deleted"`
+	RateLimits     int    `json:"rate_limits"`
+	Unavailable    string `json:"unavailable,omitempty"`
+}
+
+// WriteSummaryJSON writes a json summary of res to p for tooling, with the
+// counts of each conversation, how long the run took, who the token is and
+// the status of the run: ok, or failed or interrupted along with err. res may
+// be nil when the run failed before cleaning anything. Like the metrics file,
+// it is replaced in one rename.
+func WriteSummaryJSON(p string, res *Result, dryRun bool, err error) error {
+	s := jsonSummary{
+		Status:     StatusOK,
+		DryRun:     dryRun,
+		Identities: []Identity{},
+		Channels:   []jsonChannelStat{},
+	}
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		s.Status = StatusInterrupted
+	case err != nil:
+		s.Status = StatusFailed
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if res != nil {
+		s.DurationSeconds = res.Elapsed.Seconds()
+		s.Identities = append(s.Identities, res.Identities...)
+		for i, conv := range res.Convs {
+			st := res.Stats[i]
+			s.Channels = append(s.Channels, jsonChannelStat{
+				Channel:        conv,
+				Deleted:        st.Deleted,
+				Skipped:        st.Skipped,
+				Errors:         st.Errors,
+				Files:          st.Files,
+				Denied:         st.Denied,
+				AlreadyDeleted: st.AlreadyDeleted,
+				RateLimits:     st.RateLimits,
+				Unavailable:    st.Unavailable,
+			})
+		}
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, append(b, '\n'), 0o644)
+}
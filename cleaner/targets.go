@@ -0,0 +1,60 @@
+package cleaner
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadTargetsFile returns the user IDs or emails in a column of the CSV file
+// at p, or TSV file when p ends in .tsv, such as a spreadsheet export. The
+// first row is the header, and column is the header name of the column to
+// read, matched regardless of case, or empty for the first column. Empty
+// cells and repeats are left out.
+func ReadTargetsFile(p string, column string) ([]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	if strings.EqualFold(filepath.Ext(p), ".tsv") {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", p, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s has no header row", p)
+	}
+	col := 0
+	if column != "" {
+		col = -1
+		for i, name := range rows[0] {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				col = i
+				break
+			}
+		}
+		if col < 0 {
+			return nil, fmt.Errorf("%s has no column %q, its columns are %s", p, column, strings.Join(rows[0], ", "))
+		}
+	}
+	var users []string
+	seen := make(map[string]bool)
+	for _, row := range rows[1:] {
+		if col >= len(row) {
+			continue
+		}
+		if v := strings.TrimSpace(row[col]); v != "" && !seen[v] {
+			seen[v] = true
+			users = append(users, v)
+		}
+	}
+	return users, nil
+}
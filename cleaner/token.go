@@ -0,0 +1,57 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// The kinds of api token, as returned by TokenKind.
+const (
+	TokenBot  = "bot"
+	TokenUser = "user"
+)
+
+// TokenKind returns whether token is a bot or a user token, or "" when it
+// can not tell. auth, the auth.test response for token, has the final word
+// when it is not nil, otherwise the prefix of token is all there is to go on.
+// Rotating tokens start with xoxe. before the usual prefix.
+func TokenKind(token string, auth *slack.AuthTestResponse) string {
+	if auth != nil && auth.BotID != "" {
+		return TokenBot
+	}
+	token = strings.TrimPrefix(token, "xoxe.")
+	switch {
+	case strings.HasPrefix(token, "xoxb-"):
+		return TokenBot
+	case strings.HasPrefix(token, "xoxp-"):
+		return TokenUser
+	}
+	return ""
+}
+
+// TokenWarnings returns what a token of kind, authenticated as the user self,
+// will not be able to delete with the config, so it can be said before the
+// run rather than in a denied message for each of them. self may be empty
+// when the token was not checked with slack.
+func (c *Config) TokenWarnings(kind, self string) []string {
+	others := c.OnlyUser == "" || (self != "" && c.OnlyUser != self)
+	switch kind {
+	case TokenBot:
+		if !others {
+			return nil
+		}
+		msg := "a bot token can only delete the bot's own messages, the others will be denied"
+		if self != "" {
+			msg += fmt.Sprintf("; set onlyuser: %s to skip them", self)
+		}
+		return []string{msg}
+	case TokenUser:
+		if !others {
+			return nil
+		}
+		return []string{"a user token can only delete the messages of other users when it belongs to a workspace admin, the others will be denied"}
+	}
+	return []string{"the api token is neither a bot (xoxb-) nor a user (xoxp-) token"}
+}
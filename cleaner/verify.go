@@ -0,0 +1,32 @@
+package cleaner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+// verify reads the history of conv again once it has been cleaned, and counts
+// every message still there that the filters would have deleted in
+// stats.Leftover. Messages slack already refused to delete are not counted
+// again. Thread replies are not checked.
+func (c *Cleaner) verify(ctx context.Context, conv string, stats *ConvStats) error {
+	err := c.eachMatching(ctx, conv, "", stats.pinned, func(m slack.Message) {
+		if stats.denied[m.Timestamp] {
+			return
+		}
+		stats.Leftover++
+		LogEvent(LevelWarn, "verify_leftover",
+			fmt.Sprintf("Message in channel %s with timestamp %s is still there after deleting it", conv, m.Timestamp),
+			"channel", conv, "timestamp", m.Timestamp)
+	})
+	if err != nil {
+		return fmt.Errorf("verifying: %w", err)
+	}
+	if stats.Leftover == 0 {
+		LogEvent(LevelInfo, "verified", fmt.Sprintf("Verified channel %s has no messages left to delete", conv),
+			"channel", conv)
+	}
+	return nil
+}
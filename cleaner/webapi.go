@@ -0,0 +1,90 @@
+package cleaner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Client is a *slack.Client that also calls the web api methods the slack
+// client does not cover, the bookmarks ones and the scopes of the token, on
+// the same api url and http client. It meets API, BookmarkAPI and ScopesAPI.
+type Client struct {
+	*slack.Client
+	*webAPI
+}
+
+// NewClient returns a Client calling the web api at apiURL, or slack.APIURL
+// when it is empty, with token over client, or http.DefaultClient when it is
+// nil. apiURL ends in a slash, as for slack.OptionAPIURL.
+func NewClient(token, apiURL string, client *http.Client) *Client {
+	if apiURL == "" {
+		apiURL = slack.APIURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		Client: slack.New(token, slack.OptionAPIURL(apiURL), slack.OptionHTTPClient(client)),
+		webAPI: &webAPI{client: client, token: token, url: apiURL},
+	}
+}
+
+// webAPI calls the web api methods at url with an api token. Errors come
+// back the way the slack client returns them, as a slack.SlackErrorResponse
+// or a *slack.RateLimitedError, so they are handled the same.
+type webAPI struct {
+	client *http.Client
+	token  string
+	url    string
+}
+
+// call posts form to the web api method and decodes the response into out,
+// when set. The headers of the response are returned along with it.
+func (w *webAPI) call(ctx context.Context, method string, form url.Values, out interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+w.token)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return resp.Header, &slack.RateLimitedError{RetryAfter: time.Duration(secs) * time.Second}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.Header, fmt.Errorf("%s: %s", method, resp.Status)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.Header, fmt.Errorf("%s: reading response: %w", method, err)
+	}
+	var body struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	err = json.Unmarshal(raw, &body)
+	if err != nil {
+		return resp.Header, fmt.Errorf("%s: decoding response: %w", method, err)
+	}
+	if !body.OK {
+		return resp.Header, slack.SlackErrorResponse{Err: body.Error}
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	return resp.Header, json.Unmarshal(raw, out)
+}
@@ -0,0 +1,94 @@
+package cleaner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultWebhookTimeout is how long a webhook call may take when
+// Options.WebhookTimeout is not set.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// webhookSummary is the JSON body posted to the config's webhook once a
+// conversation is done.
+type webhookSummary struct {
+	Channel     string  `json:"channel"`
+	Deleted     int     `json:"deleted"`
+	Files       int     `json:"files"`
+	Errors      int     `json:"errors"`
+	Duration    float64 `json:"duration_seconds"`
+	DryRun      bool    `json:"dry_run"`
+	Unavailable string  `json:"unavailable,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// notify posts the stats of conv, which took elapsed and ended with err, to
+// the config's webhook if it has one. A webhook that fails is only logged,
+// since it should not stop the cleaning of the other conversations.
+func (c *Cleaner) notify(ctx context.Context, conv string, stats ConvStats, elapsed time.Duration, err error) {
+	if c.config.Webhook == "" {
+		return
+	}
+	summary := webhookSummary{
+		Channel:     conv,
+		Deleted:     stats.Deleted,
+		Files:       stats.Files,
+		Errors:      stats.Errors,
+		Duration:    elapsed.Seconds(),
+		DryRun:      c.opts.DryRun,
+		Unavailable: stats.Unavailable,
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	werr := c.postWebhook(ctx, summary)
+	if werr != nil {
+		LogEvent(LevelWarn, "webhook_failed",
+			fmt.Sprintf("Posting the summary of channel %s to the webhook failed: %s", conv, werr),
+			"channel", conv, "error", werr.Error())
+	}
+}
+
+// postWebhook posts summary as JSON to the config's webhook, within
+// opts.WebhookTimeout.
+func (c *Cleaner) postWebhook(ctx context.Context, summary webhookSummary) error {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	timeout := c.opts.WebhookTimeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.Webhook, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := c.opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// validWebhook reports whether s is an absolute http or https URL.
+func validWebhook(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
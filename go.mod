@@ -1,10 +1,11 @@
 module slack-bot-cleaner
 
-go 1.17
+go 1.21
 
 require (
 	github.com/alecthomas/kong v0.2.22
 	github.com/slack-go/slack v0.10.0
+	golang.org/x/time v0.5.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -1,166 +1,470 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/slack-go/slack"
-	"gopkg.in/yaml.v2"
+
+	"slack-bot-cleaner/cleaner"
 )
 
+const version = "1.0.0"
+
+// The exit codes of the program, for scripts to tell failures apart.
 const (
-	version = "1.0.0"
+	exitOK = iota
+	exitConfig
+	exitAuth
+	exitPartial
 )
 
-type errInvalidConfig struct{}
+// exitError is an error that ends the program with code.
+type exitError struct {
+	code int
+	err  error
+}
 
-func (e errInvalidConfig) Error() string {
-	return "Invalid Config File"
+func (e exitError) Error() string {
+	return e.err.Error()
 }
 
-// cli is the struct used for kong to parse cli args.
-var cli struct {
-	YmlPath string `arg:"" required:"" help:"The input settings file." type:"path"`
+func (e exitError) Unwrap() error {
+	return e.err
 }
 
-type config struct {
-	Token string   `yaml:"apitoken,omitempty"`
-	Convs []string `yaml:"conversation,omitempty"`
-	Users []string `yaml:"userid,omitempty"`
+// exitCode returns the exit code for err. A rejected token, or one missing
+// scopes, is exitAuth, and anything else that is not an exitError is
+// exitConfig.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	if errors.Is(err, cleaner.ErrAuthFailed) || errors.Is(err, cleaner.ErrMissingScopes) {
+		return exitAuth
+	}
+	return exitConfig
 }
 
-// start is the main entry point to the program. p is the path to the yaml file.
-func start(p string) error {
+// age is a time.Duration flag that also takes the d (day) and w (week)
+// suffixes, such as 90d.
+type age time.Duration
 
-	config, err := readYmlFile(p)
+func (a *age) Decode(ctx *kong.DecodeContext) error {
+	var s string
+	err := ctx.Scan.PopValueInto("age", &s)
 	if err != nil {
 		return err
 	}
-
-	api := slack.New(config.Token)
-
-	convs, err := getConvos(api, config)
+	d, err := cleaner.ParseAge(s)
 	if err != nil {
 		return err
 	}
+	*a = age(d)
+	return nil
+}
 
-	for _, c := range convs {
+// cli is the struct used for kong to parse cli args.
+var cli struct {
+	Version   kong.VersionFlag `help:"Print the version and exit."`
+	Token     string           `help:"The slack api token, overrides the SLACK_BOT_TOKEN env var and the settings file."`
+	LogFormat string           `default:"text" enum:"text,json" help:"The log output format, text or json."`
+	NoColor   bool             `help:"Do not color the log, which is otherwise colored when it goes to a terminal."`
+	LogLevel  string           `default:"info" enum:"debug,info,warn,error" help:"The least severe log level to print, debug, info, warn or error."`
+	Timeout   time.Duration    `help:"Stop the run after this long, 0 for no limit."`
+	Proxy     string           `help:"The http, https or socks5 proxy to reach Slack through, overrides the HTTPS_PROXY env var." placeholder:"URL"`
+	LogFile   string           `help:"Also write the log to this file, appending to it. A {timestamp} in it is replaced with the time the run started." placeholder:"PATH"`
 
-		err = deleteConvo(api, c)
-		if err != nil {
-			return err
-		}
-	}
+	Clean struct {
+		YmlPaths         []string      `arg:"" required:"" name:"yml-path" help:"The input settings files, merged together. Use - to read one from stdin." type:"path"`
+		OnlyChannels     []string      `help:"Only clean these conversations, by ID or #name, instead of the ones in the settings files." placeholder:"C1,C2"`
+		OnlyUsers        []string      `help:"Only clean the DMs with these users, by ID or email, instead of the conversations in the settings files." placeholder:"U1,U2"`
+		TargetsFile      string        `help:"Also clean the DMs with the users in a column of this CSV file, or TSV when it ends in .tsv, such as a spreadsheet export." placeholder:"FILE" type:"path"`
+		TargetsColumn    string        `help:"The header name of the column of --targets-file to read, the first column when empty." placeholder:"NAME"`
+		DryRun           bool          `help:"Log the messages that would be deleted without deleting them."`
+		Concurrency      int           `default:"1" help:"The number of conversations to clean at the same time. The messages of each are still deleted one at a time."`
+		Export           string        `help:"Write the history of each conversation to DIR/<channel>.json before deleting." placeholder:"DIR" type:"path"`
+		Yes              bool          `short:"y" help:"Skip the confirmation prompt before deleting."`
+		MaxChannels      int           `default:"50" help:"Refuse to clean more conversations than this without --force, 0 for no limit. Dry runs are not limited." placeholder:"N"`
+		Force            bool          `help:"Clean however many conversations the settings resolve to, past --max-channels."`
+		AllowEmpty       bool          `help:"Do nothing and exit 0 when the settings have no user, mpim or conversation to clean, rather than failing, for generated configs whose targets are optional."`
+		MaxAttempts      int           `default:"3" help:"The number of times to try deleting a message before giving up."`
+		ProgressEvery    int           `default:"50" help:"Log the running total of each conversation every N deleted messages, 0 to disable." placeholder:"N"`
+		Quiet            bool          `short:"q" help:"Only log the summary of each conversation, not a line per page."`
+		Verbose          bool          `short:"v" help:"Log every message deleted rather than a line per page. Implies --log-level=debug."`
+		SkipThreads      bool          `help:"Leave thread replies alone, only deleting top level messages."`
+		KeepFiles        bool          `help:"Leave the files uploaded with a message in place when deleting it."`
+		KeepPinned       bool          `help:"Leave pinned messages alone."`
+		KeepReacted      bool          `help:"Leave the messages that got any reactions alone." xor:"reacted"`
+		OnlyReacted      bool          `help:"Only delete the messages that got reactions." xor:"reacted"`
+		Unarchive        bool          `help:"Unarchive archived conversations to clean them, rather than skipping them. Needs a user token."`
+		Rearchive        bool          `help:"With --unarchive, archive the conversations again once they are cleaned."`
+		IncludeScheduled bool          `help:"Also delete the messages scheduled to be posted in each conversation."`
+		ClearReactions   bool          `help:"Remove the bot's own reactions from each message before deleting it."`
+		ClearBookmarks   bool          `help:"Also remove the bookmarks of each conversation once its messages are cleaned."`
+		Report           string        `help:"Write a CSV row to FILE for every message deleted." placeholder:"FILE" type:"path"`
+		SinceLastRun     bool          `help:"Only read the messages posted since the last successful run, as recorded in the state file."`
+		StateFile        string        `default:".slack-cleaner-state.json" help:"Where --since-last-run records the newest message seen in each conversation." placeholder:"FILE" type:"path"`
+		MetricsFile      string        `help:"Write Prometheus metrics of the run to FILE, for the node_exporter textfile collector." placeholder:"FILE" type:"path"`
+		SummaryJSON      string        `help:"Write a json summary of the run to FILE, with the counts of each conversation, the duration, who the token is and whether the run succeeded." placeholder:"FILE" type:"path"`
+		DebugDump        string        `help:"Write the raw Slack responses of every history call, and of any call that failed, to numbered files in DIR, for debugging." placeholder:"DIR" type:"path"`
+		Checkpoint       string        `help:"Record progress in FILE, and resume from it if it exists." placeholder:"FILE" type:"path"`
+		TsFile           string        `help:"Only delete the messages with the timestamps in FILE, one per line, without paging through the history." placeholder:"FILE" type:"path"`
+		PermalinksFile   string        `help:"Only delete the messages linked to in FILE, one Slack permalink per line, each in the conversation it links to." placeholder:"FILE" type:"path"`
+		OlderThan        age           `help:"Only delete messages older than this, such as 90d, 2w or 12h." placeholder:"AGE"`
+		MaxMessages      int           `help:"Stop after deleting N messages in each conversation, 0 for no limit." placeholder:"N"`
+		Order            string        `default:"newest" enum:"newest,oldest" help:"Delete the newest or the oldest messages first, so a run cut short has cleaned those."`
+		PageSize         int           `help:"The number of messages to fetch per history call, up to 1000. Defaults to Slack's page size." placeholder:"N"`
+		Verify           bool          `help:"Read each conversation again after cleaning it, and report any messages that should have been deleted but are still there."`
+		Redact           bool          `help:"Edit each message to --redact-text and drop its attachments and blocks instead of deleting it, keeping its place and thread."`
+		RedactText       string        `default:"[redacted by cleaner]" help:"The text --redact replaces messages with."`
+		Estimate         bool          `help:"Count the messages to delete in each conversation first, so progress logs include an estimate of the time remaining."`
+		TUI              bool          `help:"Show the progress live in place of the scrolling log, with a bar per conversation when --estimate is set. Only on a terminal with the text log format."`
+		RateLimitWait    time.Duration `default:"30s" help:"How long to sleep when rate limited without being told when to retry, give or take 20%."`
+		Rate             float64       `default:"0.8" help:"The most messages to delete per second across all conversations, 0 for no limit. The default stays under Slack's tier 3 limit of 50 per minute." placeholder:"N"`
+		ContinueOnError  bool          `help:"Keep cleaning the other conversations when one fails, and report all the errors at the end. This is the default." xor:"failure"`
+		FailFast         bool          `help:"Stop starting on more conversations once one fails, instead of --continue-on-error." xor:"failure"`
+		Delay            time.Duration `default:"0s" help:"Sleep this long before every delete call, such as 500ms, on top of --rate."`
+		ChannelDelay     time.Duration `default:"0s" help:"How long to wait between finishing one conversation and starting the next, to go easier on rate limits."`
+		WebhookTimeout   time.Duration `default:"10s" help:"How long posting to the webhook of the settings may take."`
+	} `cmd:"" default:"withargs" help:"Clean the conversations in the settings files. This is the default command."`
 
-	return nil
-}
+	List struct {
+		YmlPaths []string `arg:"" required:"" name:"yml-path" help:"The input settings files, merged together. Use - to read one from stdin." type:"path"`
+		Count    bool     `help:"Page through the whole history of each conversation to count exactly the messages passing the filters, instead of one cheap call each."`
+	} `cmd:"" help:"List the conversations the settings files resolve to and their message counts, without deleting anything."`
 
-// getConvos returns a list of conversation ID, that each are the conversation
-// between the bot and the user IDs.
-func getConvos(api *slack.Client, config *config) ([]string, error) {
+	Validate struct {
+		YmlPaths   []string `arg:"" required:"" name:"yml-path" help:"The input settings files, merged together. Use - to read one from stdin." type:"path"`
+		CheckToken bool     `help:"Also check the api token with Slack."`
+	} `cmd:"" help:"Check the settings files are valid without cleaning anything."`
 
-	var convs []string
+	Example struct{} `cmd:"" help:"Print a commented example settings file, to start a new one from."`
+}
 
-	if len(config.Convs) == 0 {
+// settings are those of a clean that only the command line has, as
+// cleaner.Options holds the ones of the library.
+type settings struct {
+	// paths are the yaml files, token overrides the token in them when set,
+	// and proxy is the proxy to reach slack through.
+	paths        []string
+	token, proxy string
+	// apiURL is the url of the slack web api, slack's own when empty.
+	apiURL string
+	// dumpDir, when set, is where the raw responses of slack are written,
+	// see cleaner.DumpResponses.
+	dumpDir string
+	// tsFile, when set, adds the timestamps in it to the config.
+	tsFile string
+	// only, when set, replaces the conversations and users of the files, as
+	// do the messages linked to in permalinksFile.
+	only           cleaner.Targets
+	permalinksFile string
+	// metricsFile is where the stats are written for prometheus, and
+	// summaryFile where they are written as json.
+	metricsFile, summaryFile string
+	// live shows the progress with a tui instead of the scrolling log.
+	live bool
+	// allowEmpty makes settings without any targets a run that does nothing
+	// rather than an error.
+	allowEmpty bool
+}
 
-		for _, u := range config.Users {
+// start is the main entry point to the program, cleaning with s and opts.
+// A summary of the run is printed even when it ends with errors, and errors
+// once cleaning has started are returned as an exitError with exitPartial.
+func start(ctx context.Context, s settings, opts cleaner.Options) error {
 
-			conversation, err := getConvoFromUser(api, u)
-			if err != nil {
-				return nil, err
+	if opts.Confirm != nil && !opts.DryRun {
+		for _, p := range s.paths {
+			if p == cleaner.Stdin {
+				return fmt.Errorf("reading the settings from stdin needs --yes, since the confirmation prompt reads stdin too")
 			}
+		}
+	}
 
-			convs = append(convs, conversation)
+	if s.permalinksFile != "" {
+		links, err := cleaner.ReadPermalinks(s.permalinksFile)
+		if err != nil {
+			return err
 		}
+		if len(links) == 0 {
+			// Otherwise every target of the files would be cleaned.
+			return fmt.Errorf("no permalinks in %s", s.permalinksFile)
+		}
+		s.only.Permalinks = links
 	}
 
-	return convs, nil
-}
+	config, err := cleaner.ReadYmlFilesWith(s.paths, s.token, s.only)
+	if s.allowEmpty && onlyNoTargets(err) {
+		cleaner.LogEvent(cleaner.LevelInfo, "no_targets", "No targets, nothing to do")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.tsFile != "" {
+		ts, err := cleaner.ReadTimestamps(s.tsFile)
+		if err != nil {
+			return err
+		}
+		config.Timestamps = append(config.Timestamps, ts...)
+		_, err = cleaner.ValidateYmlFile(config)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.tsFile, err)
+		}
+	}
 
-// deleteConvo will delete the all conversation history.
-func deleteConvo(api *slack.Client, conv string) error {
-	params := slack.GetConversationHistoryParameters{
-		ChannelID: conv,
+	client, err := cleaner.NewHTTPClient(s.proxy)
+	if err != nil {
+		return err
 	}
-	cont := false
-	for !cont {
-		hist, err := api.GetConversationHistory(&params)
+	if s.dumpDir != "" {
+		client, err = cleaner.DumpResponses(client, s.dumpDir)
 		if err != nil {
 			return err
 		}
-		if len(hist.Messages) == 0 {
-			log.Printf("All messages cleared for channel: %s", conv)
+	}
+
+	err = config.Refresh(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	configs, err := config.PerWorkspace()
+	if err != nil {
+		return err
+	}
+
+	opts.HTTPClient = client
+	stopLive := func() {}
+	if s.live {
+		ch := make(chan cleaner.Progress)
+		opts.Progress = ch
+		done := newTUI(os.Stderr, logCopy).run(ch)
+		stopLive = func() {
+			close(ch)
+			<-done
+		}
+	}
+	var res *cleaner.Result
+	var errs []error
+	for _, config := range configs {
+		c, err := cleaner.New(cleaner.NewClient(config.Token, s.apiURL, client), config, opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		wres, err := c.Run(ctx)
+		if errors.Is(err, cleaner.ErrTooManyChannels) {
+			err = fmt.Errorf("%w, pass --force to clean them anyway", err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if wres != nil {
+			res = joinResults(res, wres)
+		}
+		if ctx.Err() != nil {
 			break
 		}
-		for _, m := range hist.Messages {
-			log.Printf("Deleting message in channel %s with timestamp %s", conv, m.Timestamp)
-			_, _, err = api.DeleteMessage(conv, m.Timestamp)
-			if err != nil {
-				if strings.Contains(err.Error(), "slack rate limit exceeded") {
-					seconds := 30
-					log.Printf("Slack limit exceeded, sleeping for %d seconds", seconds)
-					time.Sleep(time.Duration(seconds) * time.Second)
-				} else {
-					return err
-				}
+	}
+	stopLive()
+	err = errors.Join(errs...)
+	if res != nil {
+		cleaner.PrintSummary(os.Stdout, res, opts.DryRun)
+		if ctx.Err() != nil {
+			cleaner.PrintResume(os.Stdout, res, opts.OldestFirst)
+		}
+		if s.metricsFile != "" {
+			merr := cleaner.WriteMetrics(s.metricsFile, res)
+			if merr != nil {
+				err = errors.Join(err, fmt.Errorf("writing metrics: %w", merr))
 			}
 		}
-		cont = hist.HasMore
 	}
-	return nil
+
+	if s.summaryFile != "" {
+		serr := cleaner.WriteSummaryJSON(s.summaryFile, res, opts.DryRun, err)
+		if serr != nil {
+			err = errors.Join(err, fmt.Errorf("writing json summary: %w", serr))
+		}
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case res != nil:
+		return exitError{exitPartial, err}
+	}
+	return err
 }
 
-func getConvoFromUser(api *slack.Client, user string) (string, error) {
-	conv, err := getChannelIDFromUser(user, api)
-	if err != nil {
-		return "", err
+// joinResults adds the conversations of b, the result of cleaning another
+// workspace, to a, which may be nil.
+func joinResults(a, b *cleaner.Result) *cleaner.Result {
+	if a == nil {
+		return b
 	}
-	return conv, nil
+	a.Convs = append(a.Convs, b.Convs...)
+	a.Stats = append(a.Stats, b.Stats...)
+	a.Elapsed += b.Elapsed
+	a.Identities = append(a.Identities, b.Identities...)
+	return a
 }
 
-// getChannelIDFromUser will open a DM with the provided userID string, and return the channel
-// ID so it can be used for sending messages.
-func getChannelIDFromUser(userID string, api *slack.Client) (string, error) {
-	params := slack.OpenConversationParameters{
-		Users: []string{userID},
+// onlyNoTargets reports whether err is a config error for nothing but the
+// settings having no targets, so any other problem with them still fails.
+func onlyNoTargets(err error) bool {
+	var cerr *cleaner.ConfigError
+	return errors.As(err, &cerr) && len(cerr.Errs) == 1 && errors.Is(cerr.Errs[0], cleaner.ErrNoTargets)
+}
+
+// list prints the conversations the yaml files at paths resolve to along with
+// their message counts, without deleting anything. With count the messages
+// passing the filters are counted over the whole history. token and proxy are
+// as for start.
+func list(ctx context.Context, paths []string, token, proxy string, count bool) error {
+
+	config, err := cleaner.ReadYmlFiles(paths, token)
+	if err != nil {
+		return err
+	}
+
+	client, err := cleaner.NewHTTPClient(proxy)
+	if err != nil {
+		return err
+	}
+
+	err = config.Refresh(ctx, client)
+	if err != nil {
+		return err
 	}
-	channel, _, _, err := api.OpenConversation(&params)
+
+	configs, err := config.PerWorkspace()
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	var inv []cleaner.Inventory
+	for _, config := range configs {
+		c, err := cleaner.New(cleaner.NewClient(config.Token, "", client), config, cleaner.Options{})
+		if err != nil {
+			return err
+		}
+		var winv []cleaner.Inventory
+		if count {
+			winv, err = c.Count(ctx)
+		} else {
+			winv, err = c.List(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		inv = append(inv, winv...)
 	}
-	return channel.ID, nil
+
+	cleaner.PrintInventory(os.Stdout, inv)
+	return nil
 }
 
-func readYmlFile(p string) (*config, error) {
-	b, err := os.ReadFile(p)
+// validate checks the yaml files at paths, and the api token with slack when
+// checkToken is set, printing a summary of the config when it is valid along
+// with what the kind of token will not be able to delete. token and proxy are
+// as for start.
+func validate(ctx context.Context, paths []string, token, proxy string, checkToken bool) error {
+
+	config, err := cleaner.ReadYmlFiles(paths, token)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var c config
-	err = yaml.Unmarshal(b, &c)
+
+	configs, err := config.PerWorkspace()
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	for i, config := range configs {
+		prefix := ""
+		if len(configs) > 1 {
+			prefix = fmt.Sprintf("workspace %d: ", i+1)
+		}
+
+		var auth *slack.AuthTestResponse
+		if checkToken {
+			client, err := cleaner.NewHTTPClient(proxy)
+			if err != nil {
+				return err
+			}
+			api := cleaner.NewClient(config.Token, "", client)
+			auth, err = api.AuthTestContext(ctx)
+			if err != nil {
+				return fmt.Errorf("%s%w: %w", prefix, cleaner.ErrAuthFailed, err)
+			}
+			fmt.Printf("%stoken OK: %s (%s) in team %s\n", prefix, auth.User, auth.UserID, auth.Team)
+			scopes, err := api.TokenScopesContext(ctx)
+			if err != nil {
+				return fmt.Errorf("%schecking scopes: %w", prefix, err)
+			}
+			if missing := config.MissingScopes(scopes, cleaner.Options{}); scopes != nil && len(missing) > 0 {
+				return fmt.Errorf("%s%w: %s", prefix, cleaner.ErrMissingScopes, strings.Join(missing, ", "))
+			}
+		}
+
+		kind, self := cleaner.TokenKind(config.Token, auth), ""
+		if auth != nil {
+			self = auth.UserID
+		}
+		if config.Token != "" {
+			for _, w := range config.TokenWarnings(kind, self) {
+				fmt.Printf("%swarning: %s\n", prefix, w)
+			}
+		}
+
+		fmt.Printf("%sconfig OK: %d users, %d mpim groups, %d conversations\n",
+			prefix, len(config.Users), len(config.MPIMs), len(config.Convs))
 	}
-	return validateYmlFile(&c)
+	return nil
 }
 
-// validateYmlFile will validate the config.
-func validateYmlFile(c *config) (*config, error) {
-	if c.Token == "" {
-		return nil, fmt.Errorf("invalid api token")
+// confirm prints the conversations about to be cleaned to w, and reports
+// whether the user typed "yes" on r.
+func confirm(r io.Reader, w io.Writer, convs []string) (bool, error) {
+	fmt.Fprintf(w, "About to delete messages in %d conversations:\n", len(convs))
+	for _, c := range convs {
+		fmt.Fprintf(w, "  %s\n", c)
 	}
-	if len(c.Users) == 0 && len(c.Convs) == 0 {
-		return nil, fmt.Errorf("Need either one user or conversation")
+	fmt.Fprint(w, "Type \"yes\" to continue: ")
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
 	}
-	return c, nil
+	return strings.TrimSpace(answer) == "yes", nil
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
 func main() {
-	kong.Parse(&cli,
+	kctx := kong.Parse(&cli,
 		kong.Name("Slack dm cleaner"),
 		kong.Description("An easy button to clear DMs when using a slack app"),
 		kong.UsageOnError(),
@@ -171,8 +475,159 @@ func main() {
 			"version": version,
 		},
 	)
-	err := start(cli.YmlPath)
+	err := cleaner.SetLogFormat(cli.LogFormat)
+	if err == nil {
+		level := cli.LogLevel
+		if cli.Clean.Verbose {
+			level = cleaner.LevelDebug
+		}
+		err = cleaner.SetLogLevel(level)
+	}
+	_, noColor := os.LookupEnv("NO_COLOR")
+	cleaner.SetLogColor(!cli.NoColor && !noColor && isTerminal(os.Stderr))
+	var logFile *os.File
+	if err == nil && cli.LogFile != "" {
+		logFile, err = openLogFile(cli.LogFile, time.Now())
+	}
+	if err != nil {
+		cleaner.LogEvent(cleaner.LevelError, "error", err.Error(), "error", err.Error())
+		os.Exit(1)
+	}
+	if logFile != nil {
+		logCopy = plainWriter{logFile}
+		log.SetOutput(io.MultiWriter(os.Stderr, logCopy))
+	}
+	ctx := context.Background()
+	if cli.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cli.Timeout)
+		defer cancel()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	switch kctx.Command() {
+	case "list <yml-path>":
+		err = list(ctx, cli.List.YmlPaths, cli.Token, cli.Proxy, cli.List.Count)
+	case "validate <yml-path>":
+		err = validate(ctx, cli.Validate.YmlPaths, cli.Token, cli.Proxy, cli.Validate.CheckToken)
+	case "example":
+		err = cleaner.WriteExample(os.Stdout)
+	default:
+		var extra []string
+		if cli.Clean.TargetsFile != "" {
+			extra, err = cleaner.ReadTargetsFile(cli.Clean.TargetsFile, cli.Clean.TargetsColumn)
+			if err != nil {
+				break
+			}
+		}
+		err = start(ctx, settings{
+			paths:          cli.Clean.YmlPaths,
+			token:          cli.Token,
+			proxy:          cli.Proxy,
+			dumpDir:        cli.Clean.DebugDump,
+			tsFile:         cli.Clean.TsFile,
+			only:           cleaner.Targets{Convs: cli.Clean.OnlyChannels, Users: cli.Clean.OnlyUsers, ExtraUsers: extra},
+			permalinksFile: cli.Clean.PermalinksFile,
+			metricsFile:    cli.Clean.MetricsFile,
+			summaryFile:    cli.Clean.SummaryJSON,
+			live:           cli.Clean.TUI && cli.LogFormat == "text" && isTerminal(os.Stderr),
+			allowEmpty:     cli.Clean.AllowEmpty,
+		}, cleanOptions())
+	}
 	if err != nil {
-		log.Printf("Starting slack cleaner: %s", err)
+		cleaner.LogEvent(cleaner.LevelError, "error", fmt.Sprintf("Starting slack cleaner: %s", err), "error", err.Error())
+	}
+	if logFile != nil {
+		// os.Exit skips deferred calls, so the file is closed here.
+		cerr := logFile.Close()
+		if cerr != nil {
+			fmt.Fprintf(os.Stderr, "Closing the log file: %s\n", cerr)
+		}
+	}
+	if err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+// logCopy is where the log is copied to with --log-file, or nil.
+var logCopy io.Writer
+
+// openLogFile opens the --log-file pattern for appending, with {timestamp}
+// in it replaced with now.
+func openLogFile(pattern string, now time.Time) (*os.File, error) {
+	p := strings.ReplaceAll(pattern, "{timestamp}", now.Format("20060102T150405"))
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	return f, nil
+}
+
+// colorCode matches the ANSI colors of the log.
+var colorCode = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// plainWriter writes to w with the log colors left out, which only make
+// sense on a terminal.
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	_, err := p.w.Write(colorCode.ReplaceAll(b, nil))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// cleanOptions returns the cleaner.Options set by the flags of the clean
+// command.
+func cleanOptions() cleaner.Options {
+	f := cli.Clean
+	opts := cleaner.Options{
+		DryRun:           f.DryRun,
+		Concurrency:      f.Concurrency,
+		ExportDir:        f.Export,
+		MaxAttempts:      f.MaxAttempts,
+		ProgressEvery:    f.ProgressEvery,
+		Quiet:            f.Quiet,
+		SkipThreads:      f.SkipThreads,
+		KeepFiles:        f.KeepFiles,
+		KeepPinned:       f.KeepPinned,
+		KeepReacted:      f.KeepReacted,
+		OnlyReacted:      f.OnlyReacted,
+		Unarchive:        f.Unarchive,
+		Rearchive:        f.Rearchive,
+		IncludeScheduled: f.IncludeScheduled,
+		ClearReactions:   f.ClearReactions,
+		ClearBookmarks:   f.ClearBookmarks,
+		MaxChannels:      f.MaxChannels,
+		Force:            f.Force,
+		MaxMessages:      f.MaxMessages,
+		OlderThan:        time.Duration(f.OlderThan),
+		Rate:             f.Rate,
+		WebhookTimeout:   f.WebhookTimeout,
+		FailFast:         f.FailFast,
+		Delay:            f.Delay,
+		ChannelDelay:     f.ChannelDelay,
+		RateLimitWait:    f.RateLimitWait,
+		PageSize:         f.PageSize,
+		OldestFirst:      f.Order == "oldest",
+		Estimate:         f.Estimate,
+		Verify:           f.Verify,
+		CheckpointPath:   f.Checkpoint,
+		SinceLastRun:     f.SinceLastRun,
+		StatePath:        f.StateFile,
+		ReportPath:       f.Report,
+	}
+	if f.Redact {
+		opts.Redact = f.RedactText
+	}
+	if !f.Yes {
+		opts.Confirm = func(convs []string) (bool, error) {
+			return confirm(os.Stdin, os.Stdout, convs)
+		}
 	}
+	return opts
 }
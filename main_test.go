@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"slack-bot-cleaner/cleaner"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// slackServer serves the web api methods a run over the DM of U1 calls, the
+// DM being D1 with messages in it.
+type slackServer struct {
+	*httptest.Server
+	// scopes are sent back in the X-OAuth-Scopes header of auth.test, and
+	// authErr and deleteErr, when set, are the errors auth.test and
+	// chat.delete answer with.
+	scopes             string
+	authErr, deleteErr string
+
+	mu       sync.Mutex
+	messages []string
+	calls    []string
+}
+
+// newSlackServer starts a slackServer with n messages in D1, closed when t is
+// done.
+func newSlackServer(t *testing.T, n int) *slackServer {
+	s := &slackServer{scopes: "im:history,im:read,im:write,chat:write"}
+	for i := n; i > 0; i-- {
+		s.messages = append(s.messages, fmt.Sprintf("1700000000.%06d", i))
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *slackServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	method := r.URL.Path[1:]
+	s.calls = append(s.calls, method)
+	resp := map[string]interface{}{"ok": true}
+	fail := func(err string) {
+		resp = map[string]interface{}{"ok": false, "error": err}
+	}
+	switch method {
+	case "auth.test":
+		w.Header().Set("X-OAuth-Scopes", s.scopes)
+		if s.authErr != "" {
+			fail(s.authErr)
+			break
+		}
+		resp["user"], resp["user_id"], resp["team"], resp["team_id"] = "cleaner", "UBOT", "team", "T1"
+	case "conversations.open", "conversations.info":
+		resp["channel"] = map[string]string{"id": "D1"}
+	case "conversations.history":
+		var msgs []map[string]string
+		for _, ts := range s.messages {
+			msgs = append(msgs, map[string]string{"type": "message", "ts": ts, "text": "hello"})
+		}
+		resp["messages"] = msgs
+	case "conversations.replies":
+		resp["messages"] = []interface{}{}
+	case "chat.delete":
+		if s.deleteErr != "" {
+			fail(s.deleteErr)
+			break
+		}
+		ts := r.FormValue("ts")
+		for i, m := range s.messages {
+			if m == ts {
+				s.messages = append(s.messages[:i:i], s.messages[i+1:]...)
+			}
+		}
+		resp["channel"], resp["ts"] = r.FormValue("channel"), ts
+	default:
+		fail("unknown_method")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name string
+		// bad names a settings file that does not exist instead.
+		bad       bool
+		scopes    string
+		authErr   string
+		deleteErr string
+
+		wantCode int
+		wantLeft int
+	}{
+		{name: "cleans the DM", wantCode: exitOK},
+		{name: "missing settings file", bad: true, wantCode: exitConfig, wantLeft: 3},
+		{name: "rejected token", authErr: "invalid_auth", wantCode: exitAuth, wantLeft: 3},
+		{name: "missing scopes", scopes: "im:history,im:read,im:write", wantCode: exitAuth, wantLeft: 3},
+		{name: "failed delete", deleteErr: "internal_error", wantCode: exitPartial, wantLeft: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newSlackServer(t, 3)
+			if tt.scopes != "" {
+				srv.scopes = tt.scopes
+			}
+			srv.authErr, srv.deleteErr = tt.authErr, tt.deleteErr
+			p := filepath.Join(t.TempDir(), "settings.yml")
+			if !tt.bad {
+				err := os.WriteFile(p, []byte("apitoken: xoxb-test\nuserid: [U1]\n"), 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := start(context.Background(), settings{
+				paths:  []string{p},
+				apiURL: srv.URL + "/",
+			}, cleaner.Options{MaxAttempts: 1})
+			if got := exitCode(err); got != tt.wantCode {
+				t.Errorf("got exit code %d for error %v, want %d", got, err, tt.wantCode)
+			}
+			if left := len(srv.messages); left != tt.wantLeft {
+				t.Errorf("got %d messages left, want %d", left, tt.wantLeft)
+			}
+		})
+	}
+}
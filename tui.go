@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"slack-bot-cleaner/cleaner"
+)
+
+// tuiLogLines is how many of the latest log lines the live display keeps
+// under the progress bars.
+const tuiLogLines = 5
+
+// tuiBarWidth is the width of a progress bar, between its brackets.
+const tuiBarWidth = 30
+
+// tui draws the progress of a run in place on a terminal, with a bar per
+// conversation being cleaned, the rate limit state, the totals and the time
+// elapsed, instead of the scrolling log. The log still shows its latest
+// lines under them.
+//
+// It only takes over once the run starts cleaning, so the log before that,
+// such as the confirmation prompt, prints as usual. Every line of the log is
+// also written to file, when set.
+type tui struct {
+	w    io.Writer
+	file io.Writer
+
+	mu      sync.Mutex
+	started bool
+	began   time.Time
+	queued  int
+	convs   map[string]cleaner.Progress
+	order   []string
+	paused  time.Time
+	logs    []string
+	// drawn is how many lines were drawn last, to go back up over.
+	drawn int
+}
+
+func newTUI(w, file io.Writer) *tui {
+	return &tui{w: w, file: file, convs: make(map[string]cleaner.Progress)}
+}
+
+// Write takes a line of the log, so the log package can be pointed at t.
+func (t *tui) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil {
+		_, err := t.file.Write(p)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !t.started {
+		return t.w.Write(p)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.logs = append(t.logs, line)
+	}
+	if len(t.logs) > tuiLogLines {
+		t.logs = t.logs[len(t.logs)-tuiLogLines:]
+	}
+	return len(p), nil
+}
+
+// run points the log at t and draws the updates read from ch until it is
+// closed, then draws them one last time and puts the log back. The returned
+// channel is closed once it is done.
+func (t *tui) run(ch <-chan cleaner.Progress) <-chan struct{} {
+	out := log.Writer()
+	log.SetOutput(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tick := time.NewTicker(200 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case p, ok := <-ch:
+				if !ok {
+					t.mu.Lock()
+					t.draw()
+					t.mu.Unlock()
+					log.SetOutput(out)
+					return
+				}
+				t.mu.Lock()
+				t.update(p)
+				t.mu.Unlock()
+			case <-tick.C:
+				t.mu.Lock()
+				t.draw()
+				t.mu.Unlock()
+			}
+		}
+	}()
+	return done
+}
+
+// update records p.
+func (t *tui) update(p cleaner.Progress) {
+	switch {
+	case p.Queued > 0:
+		if !t.started {
+			t.started = true
+			t.began = time.Now()
+		}
+		t.queued += p.Queued
+	case p.RateLimited > 0:
+		if until := time.Now().Add(p.RateLimited); until.After(t.paused) {
+			t.paused = until
+		}
+	case p.Conv != "":
+		if _, ok := t.convs[p.Conv]; !ok {
+			t.order = append(t.order, p.Conv)
+		}
+		t.convs[p.Conv] = p
+	}
+}
+
+// draw redraws everything over what was drawn last.
+func (t *tui) draw() {
+	if !t.started {
+		return
+	}
+	var b strings.Builder
+	if t.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", t.drawn)
+	}
+	var lines []string
+	deleted, finished := 0, 0
+	var active []string
+	for _, conv := range t.order {
+		p := t.convs[conv]
+		deleted += p.Deleted
+		if p.Done {
+			finished++
+		} else {
+			active = append(active, conv)
+		}
+	}
+	lines = append(lines, fmt.Sprintf("Cleaned %d of %d conversations, %d messages deleted, %s elapsed",
+		finished, t.queued, deleted, time.Since(t.began).Round(time.Second)))
+	if left := time.Until(t.paused); left > 0 {
+		lines = append(lines, fmt.Sprintf("Rate limited, deletes paused for %s", left.Round(time.Second)))
+	} else {
+		lines = append(lines, "Not rate limited")
+	}
+	sort.Strings(active)
+	for _, conv := range active {
+		lines = append(lines, progressLine(conv, t.convs[conv]))
+	}
+	lines = append(lines, "")
+	lines = append(lines, t.logs...)
+	for _, line := range lines {
+		b.WriteString("\x1b[2K")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	// Lines left over from a longer draw before are cleared.
+	for i := len(lines); i < t.drawn; i++ {
+		b.WriteString("\x1b[2K\n")
+	}
+	if len(lines) < t.drawn {
+		fmt.Fprintf(&b, "\x1b[%dA", t.drawn-len(lines))
+	}
+	t.drawn = len(lines)
+	io.WriteString(t.w, b.String())
+}
+
+// progressLine returns the line of conv with its bar, or only its count when
+// the total is not known.
+func progressLine(conv string, p cleaner.Progress) string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("%-12s %d deleted", conv, p.Deleted)
+	}
+	n := p.Deleted * tuiBarWidth / p.Total
+	if n > tuiBarWidth {
+		n = tuiBarWidth
+	}
+	return fmt.Sprintf("%-12s [%s%s] %3d%% %d/%d", conv, strings.Repeat("#", n), strings.Repeat("-", tuiBarWidth-n),
+		p.Deleted*100/p.Total, p.Deleted, p.Total)
+}